@@ -43,7 +43,12 @@ func GetAllCatalogs(c *gin.Context) {
 		return
 	}
 
-	catalogs, err := srv.GetAllCatalogs(c, arg.Page, arg.PageSize, arg.Order)
+	spec, err := srv.NewPageSpec(c, arg.Page, arg.PageSize, arg.Cursor, arg.Order)
+	if err != nil {
+		return
+	}
+
+	catalogs, err := srv.GetAllCatalogs(c, spec)
 	if err != nil {
 		log.For(ctx).Error("get catalogs fail", zap.Error(err))
 		return
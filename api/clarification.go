@@ -0,0 +1,164 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/srv"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/log"
+	"go.uber.org/zap"
+)
+
+// interval of keep alive event, avoid connection closed by proxy
+const streamKeepAlive = 30 * time.Second
+
+func GetClarifications(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	clarifications, err := srv.GetClarifications(c, uriArg.ID)
+	if err != nil {
+		log.For(ctx).Error("get clarifications fail", zap.Error(err), zap.Int("contestId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, clarifications)
+}
+
+func AskClarification(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+	arg := data.ClarificationArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	// bind arg
+	if !wrap.ShouldBind(c, &arg, false) {
+		return
+	}
+
+	arg.ContestID = uriArg.ID
+	clarification, err := srv.AskClarification(c, &arg)
+	if err != nil {
+		log.For(ctx).Error("ask clarification fail", zap.Error(err), zap.Int("contestId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, clarification)
+}
+
+func AnswerClarification(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := clarificationArg{}
+	arg := data.AnswerArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	// bind arg
+	if !wrap.ShouldBind(c, &arg, false) {
+		return
+	}
+
+	clarification, err := srv.AnswerClarification(c, uriArg.ID, uriArg.ClarificationID, &arg)
+	if err != nil {
+		log.For(ctx).Error("answer clarification fail", zap.Error(err),
+			zap.Int("clarificationId", uriArg.ClarificationID))
+		return
+	}
+
+	c.JSON(http.StatusOK, clarification)
+}
+
+func DeleteClarification(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := clarificationArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	if err := srv.DeleteClarification(c, uriArg.ID, uriArg.ClarificationID); err != nil {
+		log.For(ctx).Error("delete clarification fail", zap.Error(err),
+			zap.Int("clarificationId", uriArg.ClarificationID))
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func Announce(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+	arg := data.AnnouncementArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	// bind arg
+	if !wrap.ShouldBind(c, &arg, false) {
+		return
+	}
+
+	arg.ContestID = uriArg.ID
+	announcement, err := srv.Announce(c, &arg)
+	if err != nil {
+		log.For(ctx).Error("announce fail", zap.Error(err), zap.Int("contestId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, announcement)
+}
+
+// push clarification events by server-sent events
+func StreamClarifications(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	events, cancel, err := srv.SubscribeClarifications(c, uriArg.ID)
+	if err != nil {
+		log.For(ctx).Error("subscribe clarifications fail", zap.Error(err), zap.Int("contestId", uriArg.ID))
+		return
+	}
+	defer cancel()
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+		case <-ticker.C:
+			c.SSEvent("ping", "")
+		case <-ctx.Done():
+			return false
+		}
+		return true
+	})
+}
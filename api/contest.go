@@ -8,6 +8,7 @@ import (
 	"github.com/go-redis/redis"
 	"github.com/si9ma/KillOJ-backend/data"
 
+	"github.com/si9ma/KillOJ-backend/middleware"
 	"github.com/si9ma/KillOJ-backend/srv"
 
 	"github.com/si9ma/KillOJ-backend/auth"
@@ -32,7 +33,30 @@ func SetupContest(r *gin.Engine) {
 	auth.AuthGroup.GET("/contests/contest/:id/invite", GetContestInviteInfo)
 	auth.AuthGroup.GET("/contests/join/:uuid", JoinContestQuery)
 	auth.AuthGroup.POST("/contests/join/:uuid", JoinContest)
-	//auth.AuthContest.DELETE("/contests/:id", DeleteContest)
+	auth.AuthGroup.GET("/contests/contest/:id/scoreboard", GetScoreboard)
+	auth.AuthGroup.DELETE("/contests/contest/:id", DeleteContest)
+	auth.AuthGroup.POST("/contests/contest/:id/restore",
+		middleware.AuthorizateFunc(RestoreContest, model.Administrator))
+
+	// clarification
+	auth.AuthGroup.GET("/contests/contest/:id/clarifications", GetClarifications)
+	auth.AuthGroup.POST("/contests/contest/:id/clarifications", AskClarification)
+	auth.AuthGroup.GET("/contests/contest/:id/clarifications/stream", StreamClarifications)
+	auth.AuthGroup.PUT("/contests/contest/:id/clarifications/:clarification_id", AnswerClarification)
+	auth.AuthGroup.DELETE("/contests/contest/:id/clarifications/:clarification_id", DeleteClarification)
+	auth.AuthGroup.POST("/contests/contest/:id/announcements", Announce)
+
+	// registration
+	auth.AuthGroup.GET("/contests/open", GetOpenContests)
+	auth.AuthGroup.POST("/contests/contest/:id/register", RegisterContest)
+	auth.AuthGroup.GET("/contests/contest/:id/registration", GetMyRegistration)
+	auth.AuthGroup.POST("/contests/contest/:id/teams/join", JoinTeam)
+	auth.AuthGroup.GET("/contests/contest/:id/registrations", GetRegistrations)
+	auth.AuthGroup.PUT("/contests/contest/:id/registrations/:registration_id", ReviewRegistration)
+
+	// virtual participation
+	auth.AuthGroup.GET("/contests/contest/:id/virtual", GetMyVirtual)
+	auth.AuthGroup.POST("/contests/contest/:id/virtual", StartVirtual)
 }
 
 func GetAllContests(c *gin.Context) {
@@ -45,7 +69,12 @@ func GetAllContests(c *gin.Context) {
 		return
 	}
 
-	contests, err := srv.GetAllContests(c, arg.Page, arg.PageSize, arg.Order)
+	spec, err := srv.NewPageSpec(c, arg.Page, arg.PageSize, arg.Cursor, arg.Order)
+	if err != nil {
+		return
+	}
+
+	contests, err := srv.GetAllContests(c, spec)
 	if err != nil {
 		log.For(ctx).Error("get contests fail", zap.Error(err))
 		return
@@ -116,23 +145,57 @@ func UpdateContest(c *gin.Context) {
 	c.JSON(http.StatusOK, newContest)
 }
 
-//
-//func DeleteContest(c *gin.Context) {
-//	ctx := c.Request.Context()
-//	uriArg := QueryArg{}
-//
-//	// bind uri params
-//	if !wrap.ShouldBind(c, &uriArg, true) {
-//		return
-//	}
-//
-//	if err := srv.DeleteContest(c, uriArg.ID); err != nil {
-//		log.For(ctx).Error("delete contest fail", zap.Error(err), zap.Int("contestId", uriArg.ID))
-//		return
-//	}
-//
-//	c.JSON(http.StatusOK, nil)
-//}
+func GetScoreboard(c *gin.Context) {
+	ctx := c.Request.Context()
+	arg := QueryArg{}
+
+	// bind
+	if !wrap.ShouldBind(c, &arg, true) {
+		return
+	}
+
+	board, err := srv.GetScoreboard(c, arg.ID)
+	if err != nil {
+		log.For(ctx).Error("get scoreboard fail", zap.Error(err), zap.Int("contestId", arg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, board)
+}
+
+func DeleteContest(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	if err := srv.DeleteContest(c, uriArg.ID); err != nil {
+		log.For(ctx).Error("delete contest fail", zap.Error(err), zap.Int("contestId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func RestoreContest(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	if err := srv.RestoreContest(c, uriArg.ID); err != nil {
+		log.For(ctx).Error("restore contest fail", zap.Error(err), zap.Int("contestId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
 
 func GetContestInviteInfo(c *gin.Context) {
 	ctx := c.Request.Context()
@@ -156,6 +219,8 @@ func GetContestInviteInfo(c *gin.Context) {
 		return
 	}
 
+	// clear password before return
+	inviteData.Password = ""
 	c.JSON(http.StatusOK, inviteData)
 }
 
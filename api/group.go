@@ -8,6 +8,7 @@ import (
 
 	"github.com/si9ma/KillOJ-backend/data"
 
+	"github.com/si9ma/KillOJ-backend/middleware"
 	"github.com/si9ma/KillOJ-backend/srv"
 
 	"github.com/si9ma/KillOJ-backend/auth"
@@ -32,7 +33,9 @@ func SetupGroup(r *gin.Engine) {
 	auth.AuthGroup.GET("/groups/group/:id/invite", GetGroupInviteInfo)
 	auth.AuthGroup.GET("/groups/join/:uuid", JoinGroupQuery)
 	auth.AuthGroup.POST("/groups/join/:uuid", JoinGroup)
-	//auth.AuthGroup.DELETE("/groups/:id", DeleteGroup)
+	auth.AuthGroup.DELETE("/groups/group/:id", DeleteGroup)
+	auth.AuthGroup.POST("/groups/group/:id/restore",
+		middleware.AuthorizateFunc(RestoreGroup, model.Administrator))
 }
 
 func GetAllGroups(c *gin.Context) {
@@ -45,7 +48,12 @@ func GetAllGroups(c *gin.Context) {
 		return
 	}
 
-	groups, err := srv.GetAllGroups(c, arg.Page, arg.PageSize, arg.Order)
+	spec, err := srv.NewPageSpec(c, arg.Page, arg.PageSize, arg.Cursor, arg.Order)
+	if err != nil {
+		return
+	}
+
+	groups, err := srv.GetAllGroups(c, spec)
 	if err != nil {
 		log.For(ctx).Error("get groups fail", zap.Error(err))
 		return
@@ -116,23 +124,39 @@ func UpdateGroup(c *gin.Context) {
 	c.JSON(http.StatusOK, newGroup)
 }
 
-//
-//func DeleteGroup(c *gin.Context) {
-//	ctx := c.Request.Context()
-//	uriArg := QueryArg{}
-//
-//	// bind uri params
-//	if !wrap.ShouldBind(c, &uriArg, true) {
-//		return
-//	}
-//
-//	if err := srv.DeleteGroup(c, uriArg.ID); err != nil {
-//		log.For(ctx).Error("delete group fail", zap.Error(err), zap.Int("groupId", uriArg.ID))
-//		return
-//	}
-//
-//	c.JSON(http.StatusOK, nil)
-//}
+func DeleteGroup(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	if err := srv.DeleteGroup(c, uriArg.ID); err != nil {
+		log.For(ctx).Error("delete group fail", zap.Error(err), zap.Int("groupId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func RestoreGroup(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	if err := srv.RestoreGroup(c, uriArg.ID); err != nil {
+		log.For(ctx).Error("restore group fail", zap.Error(err), zap.Int("groupId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
 
 func GetGroupInviteInfo(c *gin.Context) {
 	ctx := c.Request.Context()
@@ -156,6 +180,8 @@ func GetGroupInviteInfo(c *gin.Context) {
 		return
 	}
 
+	// clear password before return
+	inviteData.Password = ""
 	c.JSON(http.StatusOK, inviteData)
 }
 
@@ -11,4 +11,8 @@ func Setup(r *gin.Engine) {
 	SetupTag(r)     // tag
 	SetupTemplate(r)     // template
 	SetupTheme(r)   // theme
+	SetupRejudge(r) // rejudge
+	SetupPlayground(r) // playground
+	SetupLanguage(r) // language
+	SetupRank(r) // rank
 }
@@ -0,0 +1,18 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/si9ma/KillOJ-backend/srv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupLanguage(r *gin.Engine) {
+	// everyone can access
+	r.GET("/languages", GetAllLanguages)
+}
+
+func GetAllLanguages(c *gin.Context) {
+	c.JSON(http.StatusOK, srv.GetAllLanguages(c))
+}
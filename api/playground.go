@@ -0,0 +1,175 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/si9ma/KillOJ-backend/data"
+
+	"github.com/si9ma/KillOJ-common/model"
+
+	"github.com/si9ma/KillOJ-backend/srv"
+
+	"github.com/si9ma/KillOJ-backend/auth"
+	"go.uber.org/zap"
+
+	"github.com/si9ma/KillOJ-common/log"
+
+	"github.com/si9ma/KillOJ-backend/wrap"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupPlayground(r *gin.Engine) {
+	// need auth, only visible to owner
+	auth.AuthGroup.GET("/playgrounds", GetAllPlaygrounds)
+	auth.AuthGroup.POST("/playgrounds", AddPlayground)
+	auth.AuthGroup.GET("/playgrounds/playground/:id", GetPlayground)
+	auth.AuthGroup.PUT("/playgrounds/playground/:id", UpdatePlayground)
+	auth.AuthGroup.DELETE("/playgrounds/playground/:id", DeletePlayground)
+	auth.AuthGroup.GET("/playgrounds/playground/:id/histories", GetPlaygroundHistories)
+	auth.AuthGroup.POST("/playgrounds/run", Run)
+	auth.AuthGroup.GET("/playgrounds/runs/:uuid", GetRunResult)
+}
+
+func GetAllPlaygrounds(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	playgrounds, err := srv.GetAllPlaygrounds(c)
+	if err != nil {
+		log.For(ctx).Error("get playgrounds fail", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, playgrounds)
+}
+
+func GetPlayground(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	playground, err := srv.GetPlayground(c, uriArg.ID)
+	if err != nil {
+		log.For(ctx).Error("get playground fail", zap.Error(err), zap.Int("playgroundId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, playground)
+}
+
+func AddPlayground(c *gin.Context) {
+	ctx := c.Request.Context()
+	newPlayground := model.Playground{}
+
+	// bind
+	if !wrap.ShouldBind(c, &newPlayground, false) {
+		return
+	}
+
+	if err := srv.AddPlayground(c, &newPlayground); err != nil {
+		log.For(ctx).Error("add playground fail", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, newPlayground)
+}
+
+func UpdatePlayground(c *gin.Context) {
+	ctx := c.Request.Context()
+	newPlayground := model.Playground{}
+	uriArg := QueryArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	// bind request params
+	if !wrap.ShouldBind(c, &newPlayground, false) {
+		return
+	}
+
+	// use id in uri path
+	newPlayground.ID = uriArg.ID
+	if err := srv.UpdatePlayground(c, &newPlayground); err != nil {
+		log.For(ctx).Error("update playground fail", zap.Error(err), zap.Int("playgroundId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, newPlayground)
+}
+
+func DeletePlayground(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	if err := srv.DeletePlayground(c, uriArg.ID); err != nil {
+		log.For(ctx).Error("delete playground fail", zap.Error(err), zap.Int("playgroundId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func GetPlaygroundHistories(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	histories, err := srv.GetPlaygroundHistories(c, uriArg.ID)
+	if err != nil {
+		log.For(ctx).Error("get playground histories fail", zap.Error(err), zap.Int("playgroundId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, histories)
+}
+
+func Run(c *gin.Context) {
+	ctx := c.Request.Context()
+	arg := data.RunArg{}
+
+	// bind
+	if !wrap.ShouldBind(c, &arg, false) {
+		return
+	}
+
+	info, err := srv.Run(c, &arg)
+	if err != nil {
+		log.For(ctx).Error("run code fail", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+func GetRunResult(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := uuidArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	res, err := srv.GetRunResult(c, uriArg.UUID)
+	if err != nil {
+		log.For(ctx).Error("get run result fail", zap.Error(err), zap.String("uuid", uriArg.UUID))
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
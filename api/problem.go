@@ -1,7 +1,14 @@
 package api
 
 import (
+	"fmt"
+	"io"
 	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/si9ma/KillOJ-common/constants"
+	"github.com/si9ma/KillOJ-common/judge"
 
 	"github.com/si9ma/KillOJ-backend/kerror"
 
@@ -9,6 +16,8 @@ import (
 
 	"github.com/si9ma/KillOJ-common/model"
 
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/middleware"
 	"github.com/si9ma/KillOJ-backend/srv"
 
 	"github.com/si9ma/KillOJ-backend/auth"
@@ -24,9 +33,17 @@ import (
 func SetupProblem(r *gin.Engine) {
 	// need auth
 	auth.AuthGroup.GET("/problems", GetAllProblems)
+	auth.AuthGroup.GET("/problems/search", SearchProblems)
 	auth.AuthGroup.GET("/problems/problem/:id", GetProblem)
 	auth.AuthGroup.POST("/problems", AddProblem)
+	auth.AuthGroup.POST("/problems/import", ImportProblems)
 	auth.AuthGroup.PUT("/problems/problem/:id", UpdateProblem)
+	auth.AuthGroup.GET("/problems/problem/:id/export", ExportProblem)
+	auth.AuthGroup.PUT("/problems/problem/:id/test_cases/:case_id/:kind", UploadTestData)
+	auth.AuthGroup.GET("/problems/problem/:id/test_cases/:case_id/:kind", GetTestData)
+	auth.AuthGroup.GET("/problems/problem/:id/revisions", GetRevisions)
+	auth.AuthGroup.GET("/problems/problem/:id/revisions/diff", DiffRevisions)
+	auth.AuthGroup.POST("/problems/problem/:id/revisions/:log_id/rollback", RollbackProblem)
 	auth.AuthGroup.POST("/problems/problem/:id/vote", VoteProblem)
 	auth.AuthGroup.POST("/problems/problem/:id/submit", Submit)
 	auth.AuthGroup.GET("/problems/problem/:id/lastsubmit", GetLastSubmit)
@@ -34,7 +51,13 @@ func SetupProblem(r *gin.Engine) {
 	auth.AuthGroup.POST("/problems/problem/:id/comment", Comment4Problem)
 	auth.AuthGroup.GET("/submits", GetAllSubmit)
 	auth.AuthGroup.GET("/submits/:id", GetSubmit)
-	//auth.AuthProblem.DELETE("/problems/:id", DeleteProblem)
+	auth.AuthGroup.GET("/submits/:id/result", GetSubmitResult)
+	auth.AuthGroup.GET("/submits/:id/stream", StreamResult)
+	auth.AuthGroup.DELETE("/problems/problem/:id", DeleteProblem)
+	auth.AuthGroup.POST("/problems/problem/:id/restore",
+		middleware.AuthorizateFunc(RestoreProblem, model.Administrator))
+	auth.AuthGroup.POST("/test_data/clean",
+		middleware.AuthorizateFunc(CleanTestData, model.Administrator))
 }
 
 func GetAllProblems(c *gin.Context) {
@@ -47,7 +70,12 @@ func GetAllProblems(c *gin.Context) {
 		return
 	}
 
-	problems, err := srv.GetAllProblems(c, arg.Page, arg.PageSize, arg.Order, arg.Of, arg.ID)
+	spec, err := srv.NewPageSpec(c, arg.Page, arg.PageSize, arg.Cursor, arg.Order)
+	if err != nil {
+		return
+	}
+
+	problems, err := srv.GetAllProblems(c, spec, arg.Of, arg.ID)
 	if err != nil {
 		log.For(ctx).Error("get problems fail", zap.Error(err))
 		return
@@ -56,6 +84,30 @@ func GetAllProblems(c *gin.Context) {
 	c.JSON(http.StatusOK, problems)
 }
 
+func SearchProblems(c *gin.Context) {
+	ctx := c.Request.Context()
+	arg := data.ProblemSearchArg{}
+
+	// bind query params
+	if !wrap.ShouldBind(c, &arg, false) {
+		return
+	}
+
+	// sorted by relevance
+	spec, err := srv.NewPageSpec(c, arg.Page, arg.PageSize, arg.Cursor, "")
+	if err != nil {
+		return
+	}
+
+	problems, err := srv.SearchProblems(c, spec, &arg)
+	if err != nil {
+		log.For(ctx).Error("search problems fail", zap.Error(err), zap.String("keyword", arg.Keyword))
+		return
+	}
+
+	c.JSON(http.StatusOK, problems)
+}
+
 func GetProblem(c *gin.Context) {
 	ctx := c.Request.Context()
 	uriArg := QueryArg{}
@@ -133,6 +185,138 @@ func UpdateProblem(c *gin.Context) {
 	c.JSON(http.StatusOK, newProblem)
 }
 
+func ExportProblem(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	res, err := srv.ExportProblem(c, uriArg.ID)
+	if err != nil {
+		log.For(ctx).Error("export problem fail", zap.Error(err), zap.Int("problemId", uriArg.ID))
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=problem_%d.zip", uriArg.ID))
+	c.Data(http.StatusOK, "application/zip", res)
+}
+
+// upload test data by request body, kind is input or output
+func UploadTestData(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := testDataArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, gbl.MaxTestDataSize)
+	testCase, err := srv.UploadTestData(c, uriArg.ID, uriArg.CaseID, uriArg.Kind, body)
+	if err != nil {
+		log.For(ctx).Error("upload test data fail", zap.Error(err),
+			zap.Int("problemId", uriArg.ID), zap.Int("caseId", uriArg.CaseID))
+		return
+	}
+
+	c.JSON(http.StatusOK, testCase)
+}
+
+func GetTestData(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := testDataArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	r, size, sum, err := srv.GetTestData(c, uriArg.ID, uriArg.CaseID, uriArg.Kind)
+	if err != nil {
+		log.For(ctx).Error("get test data fail", zap.Error(err),
+			zap.Int("problemId", uriArg.ID), zap.Int("caseId", uriArg.CaseID))
+		return
+	}
+	defer r.Close()
+
+	ext := "in"
+	if uriArg.Kind == srv.TestDataOutput {
+		ext = "out"
+	}
+	c.DataFromReader(http.StatusOK, size, "application/octet-stream", r, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%d.%s", uriArg.CaseID, ext),
+		"X-Checksum-Sha256":   sum,
+	})
+}
+
+func ImportProblems(c *gin.Context) {
+	ctx := c.Request.Context()
+	arg := data.ImportProblemArg{}
+
+	// bind form params
+	if !wrap.ShouldBind(c, &arg, false) {
+		return
+	}
+
+	problems, err := srv.ImportProblems(c, &arg)
+	if err != nil {
+		log.For(ctx).Error("import problems fail", zap.Error(err), zap.String("file", arg.File.Filename))
+		return
+	}
+
+	c.JSON(http.StatusOK, problems)
+}
+
+func DeleteProblem(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	if err := srv.DeleteProblem(c, uriArg.ID); err != nil {
+		log.For(ctx).Error("delete problem fail", zap.Error(err), zap.Int("problemId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func RestoreProblem(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	if err := srv.RestoreProblem(c, uriArg.ID); err != nil {
+		log.For(ctx).Error("restore problem fail", zap.Error(err), zap.Int("problemId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+// remove test data which isn't referenced by any test case or revision
+func CleanTestData(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	result, err := srv.CleanTestData(c)
+	if err != nil {
+		log.For(ctx).Error("clean test data fail", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 func VoteProblem(c *gin.Context) {
 	ctx := c.Request.Context()
 	vote := model.UserVoteProblem{}
@@ -257,7 +441,12 @@ func GetAllSubmit(c *gin.Context) {
 		return
 	}
 
-	submits, err := srv.GetAllSubmit(c, arg.Page, arg.PageSize, arg.Order, arg.Of, arg.ID, arg.OnlyDuringContest)
+	spec, err := srv.NewPageSpec(c, arg.Page, arg.PageSize, arg.Cursor, arg.Order)
+	if err != nil {
+		return
+	}
+
+	submits, err := srv.GetAllSubmit(c, spec, arg.Of, arg.ID, arg.OnlyDuringContest)
 	if err != nil {
 		log.For(ctx).Error("get submits fail", zap.Error(err))
 		return
@@ -283,3 +472,83 @@ func GetSubmit(c *gin.Context) {
 
 	c.JSON(http.StatusOK, submit)
 }
+
+func GetSubmitResult(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	result, err := srv.GetSubmitResult(c, uriArg.ID)
+	if err != nil {
+		log.For(ctx).Error("get result of submit fail", zap.Error(err), zap.Int("submitID", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// push judge status of submit by server-sent events:
+// status(judging) --> progress(every time status changed) --> result
+func StreamResult(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	submit, err := srv.GetSubmit(c, uriArg.ID)
+	if err != nil {
+		log.For(ctx).Error("get submit info", zap.Error(err), zap.Int("submitID", uriArg.ID))
+		return
+	}
+
+	// check permission
+	if err := srv.CheckSubmitResultPermission(c, submit); err != nil {
+		return
+	}
+
+	var last *judge.OuterResult
+	ticker := time.NewTicker(srv.ResultPollInterval)
+	defer ticker.Stop()
+	timeout := time.After(constants.SubmitStatusTimeout)
+
+	c.Stream(func(w io.Writer) bool {
+		result, err := srv.GetSubmitStatus(c, submit.ID)
+		if err != nil {
+			log.For(ctx).Error("get status of submit fail", zap.Error(err), zap.Int("submitID", submit.ID))
+			c.SSEvent("error", gin.H{"error": kerror.ErrInternalServerErrorGeneral})
+			return false
+		}
+
+		switch {
+		case result.IsComplete:
+			c.SSEvent("result", result)
+			return false
+		case last == nil:
+			c.SSEvent("status", judge.JudgingStatus)
+			if result.TestCaseNum > 0 {
+				c.SSEvent("progress", result)
+			}
+		case !reflect.DeepEqual(*last, *result):
+			c.SSEvent("progress", result)
+		}
+		last = result
+
+		select {
+		case <-ticker.C:
+			return true
+		case <-ctx.Done(): // client gone
+			return false
+		case <-timeout:
+			log.For(ctx).Error("wait result of submit timeout", zap.Int("submitID", submit.ID))
+			c.SSEvent("error", gin.H{"error": kerror.ErrNotComplete})
+			return false
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/srv"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/log"
+	"go.uber.org/zap"
+)
+
+func GetRevisions(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	revisions, err := srv.GetRevisions(c, uriArg.ID)
+	if err != nil {
+		log.For(ctx).Error("get revisions of problem fail", zap.Error(err), zap.Int("problemId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+func DiffRevisions(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+	arg := data.RevisionDiffArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	// bind query params
+	if !wrap.ShouldBind(c, &arg, false) {
+		return
+	}
+
+	diff, err := srv.DiffRevisions(c, uriArg.ID, &arg)
+	if err != nil {
+		log.For(ctx).Error("diff revisions of problem fail", zap.Error(err), zap.Int("problemId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+func RollbackProblem(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := revisionArg{}
+	arg := data.RollbackArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	// bind request params, request body is optional
+	if c.Request.ContentLength != 0 && !wrap.ShouldBind(c, &arg, false) {
+		return
+	}
+
+	if err := srv.RollbackProblem(c, uriArg.ID, uriArg.LogID, &arg); err != nil {
+		log.For(ctx).Error("rollback problem fail", zap.Error(err),
+			zap.Int("problemId", uriArg.ID), zap.Int("logId", uriArg.LogID))
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
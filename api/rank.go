@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/si9ma/KillOJ-backend/auth"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/middleware"
+	"github.com/si9ma/KillOJ-backend/srv"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"go.uber.org/zap"
+)
+
+func SetupRank(r *gin.Engine) {
+	// need auth
+	auth.AuthGroup.GET("/ranks", GetRank)
+	auth.AuthGroup.POST("/admin/ranks/rebuild",
+		middleware.AuthorizateFunc(RebuildRank, model.Administrator))
+}
+
+func GetRank(c *gin.Context) {
+	ctx := c.Request.Context()
+	arg := data.RankArg{}
+
+	// bind query params
+	if !wrap.ShouldBind(c, &arg, false) {
+		return
+	}
+
+	list, err := srv.GetRank(c, &arg)
+	if err != nil {
+		log.For(ctx).Error("get rank fail", zap.Error(err), zap.String("of", arg.Of))
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func RebuildRank(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	if err := srv.RebuildRank(c); err != nil {
+		log.For(ctx).Error("rebuild rank fail", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/srv"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/log"
+	"go.uber.org/zap"
+)
+
+func GetOpenContests(c *gin.Context) {
+	ctx := c.Request.Context()
+	arg := PageArg{}
+
+	// bind
+	if !wrap.ShouldBind(c, &arg, false) {
+		return
+	}
+
+	spec, err := srv.NewPageSpec(c, arg.Page, arg.PageSize, arg.Cursor, arg.Order)
+	if err != nil {
+		return
+	}
+
+	contests, err := srv.GetOpenContests(c, spec)
+	if err != nil {
+		log.For(ctx).Error("get open contests fail", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, contests)
+}
+
+func RegisterContest(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+	arg := data.RegisterArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	// bind arg
+	if !wrap.ShouldBind(c, &arg, false) {
+		return
+	}
+
+	registration, err := srv.RegisterContest(c, uriArg.ID, &arg)
+	if err != nil {
+		log.For(ctx).Error("register contest fail", zap.Error(err), zap.Int("contestId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, registration)
+}
+
+func JoinTeam(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+	arg := data.JoinTeamArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	// bind arg
+	if !wrap.ShouldBind(c, &arg, false) {
+		return
+	}
+
+	team, err := srv.JoinTeam(c, uriArg.ID, &arg)
+	if err != nil {
+		log.For(ctx).Error("join team fail", zap.Error(err), zap.Int("contestId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, team)
+}
+
+func GetMyRegistration(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	registration, err := srv.GetMyRegistration(c, uriArg.ID)
+	if err != nil {
+		log.For(ctx).Error("get registration fail", zap.Error(err), zap.Int("contestId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, registration)
+}
+
+func GetRegistrations(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+	arg := data.RegistrationListArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	// bind query params
+	if !wrap.ShouldBind(c, &arg, false) {
+		return
+	}
+
+	registrations, err := srv.GetRegistrations(c, uriArg.ID, &arg)
+	if err != nil {
+		log.For(ctx).Error("get registrations fail", zap.Error(err), zap.Int("contestId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, registrations)
+}
+
+func ReviewRegistration(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := registrationArg{}
+	arg := data.ReviewArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	// bind arg
+	if !wrap.ShouldBind(c, &arg, false) {
+		return
+	}
+
+	registration, err := srv.ReviewRegistration(c, uriArg.ID, uriArg.RegistrationID, &arg)
+	if err != nil {
+		log.For(ctx).Error("review registration fail", zap.Error(err),
+			zap.Int("registrationId", uriArg.RegistrationID))
+		return
+	}
+
+	c.JSON(http.StatusOK, registration)
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/si9ma/KillOJ-backend/data"
+
+	"github.com/si9ma/KillOJ-backend/srv"
+
+	"github.com/si9ma/KillOJ-backend/auth"
+	"go.uber.org/zap"
+
+	"github.com/si9ma/KillOJ-common/log"
+
+	"github.com/si9ma/KillOJ-backend/wrap"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupRejudge(r *gin.Engine) {
+	// need auth, only owner or administrator
+	auth.AuthGroup.POST("/submits/:id/rejudge", RejudgeSubmit)
+	auth.AuthGroup.POST("/problems/problem/:id/rejudge", RejudgeProblem)
+	auth.AuthGroup.POST("/contests/contest/:id/rejudge", RejudgeContest)
+	auth.AuthGroup.GET("/rejudges/:uuid", GetRejudgeProgress)
+}
+
+func rejudge(c *gin.Context, of string, do func(c *gin.Context, id int) (*data.RejudgeProgress, error)) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	progress, err := do(c, uriArg.ID)
+	if err != nil {
+		log.For(ctx).Error("rejudge fail", zap.Error(err), zap.String("of", of), zap.Int("id", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
+
+func RejudgeSubmit(c *gin.Context) {
+	rejudge(c, "submit", srv.RejudgeSubmit)
+}
+
+func RejudgeProblem(c *gin.Context) {
+	rejudge(c, "problem", srv.RejudgeProblem)
+}
+
+func RejudgeContest(c *gin.Context) {
+	rejudge(c, "contest", srv.RejudgeContest)
+}
+
+func GetRejudgeProgress(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := uuidArg{}
+
+	// bind uri
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	progress, err := srv.GetRejudgeProgress(c, uriArg.UUID)
+	if err != nil {
+		log.For(ctx).Error("get rejudge progress fail", zap.Error(err), zap.String("uuid", uriArg.UUID))
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
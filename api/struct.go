@@ -1,17 +1,21 @@
 package api
 
+// order is a comma separated list of "field", "-field" or "field asc|desc",
+// page is ignored when cursor exist
 type PageArg struct {
-	Page     int    `json:"page" form:"page" binding:"required,min=1"`
-	PageSize int    `json:"page_size" form:"page_size" binding:"required,min=1"`
-	Order    string `json:"order" form:"order"`
+	Page     int    `json:"page" form:"page" binding:"omitempty,min=1"`
+	PageSize int    `json:"page_size" form:"page_size" binding:"required,min=1,max=100"`
+	Cursor   string `json:"cursor" form:"cursor"`
+	Order    string `json:"order" form:"order" binding:"max=100"`
 	Of       string `json:"of" form:"of" binding:"omitempty,oneof=group tag contest"`
 	ID       int    `json:"id" form:"id" binding:"requiredwhenfield=Of"`
 }
 
 type SubmitGetArg struct {
-	Page              int    `json:"page" form:"page" binding:"required,min=1"`
-	PageSize          int    `json:"page_size" form:"page_size" binding:"required,min=1"`
-	Order             string `json:"order" form:"order"`
+	Page              int    `json:"page" form:"page" binding:"omitempty,min=1"`
+	PageSize          int    `json:"page_size" form:"page_size" binding:"required,min=1,max=100"`
+	Cursor            string `json:"cursor" form:"cursor"`
+	Order             string `json:"order" form:"order" binding:"max=100"`
 	Of                string `json:"of" form:"of" binding:"omitempty,oneof=group contest problem me user"`
 	ID                int    `json:"id" form:"id" binding:"requiredwhenfield=Of"`
 	OnlyDuringContest bool   `json:"only_during_contest"`
@@ -36,3 +40,24 @@ type QueryExtraArg struct {
 type getSubmitArg struct {
 	Success bool `json:"success" form:"success"`
 }
+
+type testDataArg struct {
+	ID     int    `uri:"id" binding:"required"`
+	CaseID int    `uri:"case_id" binding:"required"`
+	Kind   string `uri:"kind" binding:"required,oneof=input output"`
+}
+
+type revisionArg struct {
+	ID    int `uri:"id" binding:"required"`
+	LogID int `uri:"log_id" binding:"required"`
+}
+
+type clarificationArg struct {
+	ID              int `uri:"id" binding:"required"`
+	ClarificationID int `uri:"clarification_id" binding:"required"`
+}
+
+type registrationArg struct {
+	ID             int `uri:"id" binding:"required"`
+	RegistrationID int `uri:"registration_id" binding:"required"`
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/si9ma/KillOJ-backend/wrap"
 
 	"github.com/si9ma/KillOJ-backend/middleware"
+	"github.com/si9ma/KillOJ-backend/srv"
 
 	"github.com/si9ma/KillOJ-backend/auth"
 
@@ -44,6 +45,7 @@ func SetupUser(r *gin.Engine) {
 	auth.AuthGroup.PUT(ProfilePath, UserInfoEdit)
 	auth.AuthGroup.GET(ProfilePath, GetUserInfo)
 	auth.AuthGroup.GET("/user/:id", GetOtherUserInfo)
+	auth.AuthGroup.GET("/user/:id/stats", GetUserStats)
 	auth.AuthGroup.GET("/users",
 		middleware.AuthorizateFunc(GetAllUsers, model.Administrator))
 	auth.AuthGroup.PUT("/admin/maintainers/:id",
@@ -249,6 +251,24 @@ func GetOtherUserInfo(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
+func GetUserStats(c *gin.Context) {
+	ctx := c.Request.Context()
+	arg := QueryArg{}
+
+	// bind uri
+	if !wrap.ShouldBind(c, &arg, true) {
+		return
+	}
+
+	stats, err := srv.GetUserStats(c, arg.ID)
+	if err != nil {
+		log.For(ctx).Error("get stats of user fail", zap.Error(err), zap.Int("userId", arg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
 type updateMaintainerArg struct {
 	Role int `json:"role" binding:"exists,oneof=1 2"`
 }
@@ -314,20 +334,28 @@ func GetAllMaintainers(c *gin.Context) {
 	if !wrap.ShouldBind(c, &arg, false) {
 		return
 	}
-	offset := (arg.Page - 1) * arg.PageSize
+	spec, err := srv.NewPageSpec(c, arg.Page, arg.PageSize, arg.Cursor, arg.Order)
+	if err != nil {
+		return
+	}
+	if err := srv.CheckSort(c, spec.Sorts, srv.UserSortFields); err != nil {
+		return
+	}
 
-	var users []model.User
-	if arg.Order != "" {
-		err = db.Where("role = ?", model.Maintainer).Order(arg.Order).Offset(offset).Limit(arg.PageSize).Find(&users).Error
-	} else {
-		err = db.Where("role = ?", model.Maintainer).Offset(offset).Limit(arg.PageSize).Find(&users).Error
+	total := 0
+	queryDB := db.Model(&model.User{}).Where("role = ?", model.Maintainer)
+	if err = queryDB.Count(&total).Error; mysql.ErrorHandleAndLog(c, err, true, "count maintainers", nil) != mysql.Success {
+		return
 	}
+
+	var users []model.User
+	err = srv.OrderBy(queryDB, spec.Sorts, srv.UserSortFields).Offset(spec.Offset).Limit(spec.Limit).Find(&users).Error
 	if mysql.ErrorHandleAndLog(c, err, true, "get maintainers", nil) != mysql.Success {
 		return
 	}
 
 	log.For(ctx).Info("success get maintainers")
-	c.JSON(http.StatusOK, users)
+	c.JSON(http.StatusOK, srv.NewPageResult(spec, total, users))
 }
 
 func GetAllUsers(c *gin.Context) {
@@ -341,18 +369,26 @@ func GetAllUsers(c *gin.Context) {
 	if !wrap.ShouldBind(c, &arg, false) {
 		return
 	}
-	offset := (arg.Page - 1) * arg.PageSize
+	spec, err := srv.NewPageSpec(c, arg.Page, arg.PageSize, arg.Cursor, arg.Order)
+	if err != nil {
+		return
+	}
+	if err := srv.CheckSort(c, spec.Sorts, srv.UserSortFields); err != nil {
+		return
+	}
 
-	var users []model.User
-	if arg.Order != "" {
-		err = db.Order(arg.Order).Offset(offset).Limit(arg.PageSize).Find(&users).Error
-	} else {
-		err = db.Offset(offset).Limit(arg.PageSize).Find(&users).Error
+	total := 0
+	queryDB := db.Model(&model.User{})
+	if err = queryDB.Count(&total).Error; mysql.ErrorHandleAndLog(c, err, true, "count users", nil) != mysql.Success {
+		return
 	}
+
+	var users []model.User
+	err = srv.OrderBy(queryDB, spec.Sorts, srv.UserSortFields).Offset(spec.Offset).Limit(spec.Limit).Find(&users).Error
 	if mysql.ErrorHandleAndLog(c, err, true, "get users", nil) != mysql.Success {
 		return
 	}
 
 	log.For(ctx).Info("success get users")
-	c.JSON(http.StatusOK, users)
+	c.JSON(http.StatusOK, srv.NewPageResult(spec, total, users))
 }
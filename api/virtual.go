@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/srv"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/log"
+	"go.uber.org/zap"
+)
+
+func StartVirtual(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+	arg := data.VirtualArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	// bind arg
+	if !wrap.ShouldBind(c, &arg, false) {
+		return
+	}
+
+	virtual, err := srv.StartVirtual(c, uriArg.ID, &arg)
+	if err != nil {
+		log.For(ctx).Error("start virtual participation fail", zap.Error(err), zap.Int("contestId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, virtual)
+}
+
+func GetMyVirtual(c *gin.Context) {
+	ctx := c.Request.Context()
+	uriArg := QueryArg{}
+
+	// bind uri params
+	if !wrap.ShouldBind(c, &uriArg, true) {
+		return
+	}
+
+	virtual, err := srv.GetMyVirtual(c, uriArg.ID)
+	if err != nil {
+		log.For(ctx).Error("get virtual participation fail", zap.Error(err), zap.Int("contestId", uriArg.ID))
+		return
+	}
+
+	c.JSON(http.StatusOK, virtual)
+}
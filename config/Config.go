@@ -1,22 +1,33 @@
 package config
 
 import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/si9ma/KillOJ-backend/language"
+	"github.com/si9ma/KillOJ-backend/store"
 	"github.com/si9ma/KillOJ-common/asyncjob"
 	"github.com/si9ma/KillOJ-common/kredis"
 	"github.com/si9ma/KillOJ-common/mysql"
 )
 
 type Config struct {
-	AsyncJob   asyncjob.Config `yaml:"asyncJob"`
-	Mysql      mysql.Config    `yaml:"mysql"`
-	Redis      kredis.Config   `yaml:"redis"`
-	App        AppConfig       `yaml:"app"`
-	AuthConfig AuthConfig      `yaml:"auth"`
+	AsyncJob   asyncjob.Config     `yaml:"asyncJob"`
+	Mysql      mysql.Config        `yaml:"mysql"`
+	Redis      kredis.Config       `yaml:"redis"`
+	App        AppConfig           `yaml:"app"`
+	AuthConfig AuthConfig          `yaml:"auth"`
+	Store      store.Config        `yaml:"store"`
+	Languages  []language.Language `yaml:"languages"` // use default languages when empty
 }
 
 type AppConfig struct {
 	Host string `yaml:"host"`
 	Port string `yaml:"port"`
+	// CIDR or ip of reverse proxies in front of backend,
+	// forwarded headers are only trusted when peer is one of them
+	TrustedProxies []string `yaml:"trustedProxies"`
 }
 
 type AuthConfig struct {
@@ -26,3 +37,29 @@ type AuthConfig struct {
 func (a AppConfig) Addr() string {
 	return a.Host + ":" + a.Port
 }
+
+// parse trusted proxies, single ip is treated as a host network
+func (a AppConfig) TrustedNets() ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(a.TrustedProxies))
+	for _, proxy := range a.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %s", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %s: %v", proxy, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
@@ -0,0 +1,34 @@
+package data
+
+import "github.com/si9ma/KillOJ-common/model"
+
+type ClarificationArg struct {
+	ContestID int
+	ProblemID int    `json:"problem_id" binding:"min=0"` // 0 means the whole contest
+	Question  string `json:"question" binding:"required,max=2000"`
+}
+
+type AnswerArg struct {
+	Answer   string `json:"answer" binding:"required,max=2000"`
+	IsPublic bool   `json:"is_public"` // broadcast answer to all participants
+}
+
+type AnnouncementArg struct {
+	ContestID int
+	ProblemID int    `json:"problem_id" binding:"min=0"`
+	Content   string `json:"content" binding:"required,max=2000"`
+}
+
+// type of clarification event
+const (
+	ClarificationAsked     = "ask"
+	ClarificationAnswered  = "answer"
+	ClarificationAnnounced = "announce"
+	ClarificationDeleted   = "delete"
+)
+
+// event pushed to participants of contest
+type ClarificationEvent struct {
+	Type          string              `json:"type"`
+	Clarification model.Clarification `json:"clarification"`
+}
@@ -0,0 +1,10 @@
+package data
+
+import "time"
+
+// submit sent to judger, it's collected after judge complete
+type JudgingSubmit struct {
+	SubmitID int       `json:"submit_id"`
+	SentAt   time.Time `json:"sent_at"`
+	Rejudge  bool      `json:"rejudge"`
+}
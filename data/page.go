@@ -0,0 +1,21 @@
+package data
+
+// sort key of list, field is the name exposed to client,
+// it's mapped to column by whitelist of the resource
+type SortSpec struct {
+	Field string
+	Desc  bool
+}
+
+type PageSpec struct {
+	Offset int
+	Limit  int
+	Sorts  []SortSpec
+}
+
+// page of list, next cursor is empty when there is no more item
+type PageResult struct {
+	Total      int         `json:"total"`
+	NextCursor string      `json:"next_cursor"`
+	Items      interface{} `json:"items"`
+}
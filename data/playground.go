@@ -0,0 +1,11 @@
+package data
+
+type RunArg struct {
+	SourceCode string `json:"source_code" binding:"required,max=65535"` // same limit as source code of submit
+	Language   int    `json:"language" binding:"exists,language"`
+	Input      string `json:"input" binding:"max=65536"` // stdin of program
+}
+
+type RunInfo struct {
+	ID string `json:"id"` // query result by id
+}
@@ -0,0 +1,94 @@
+package data
+
+import (
+	"encoding/xml"
+	"mime/multipart"
+
+	"github.com/si9ma/KillOJ-common/model"
+)
+
+const (
+	PackageFormatKillOJ = "killoj"
+	PackageFormatFPS    = "fps"
+)
+
+// current version of killoj problem package
+const PackageVersion = 1
+
+// manifest of killoj problem package, stored as problem.json in zip,
+// input and output of samples and test cases are stored as separate files
+type ProblemPackage struct {
+	Version     int                `json:"version"`
+	Name        string             `json:"name"`
+	Desc        string             `json:"desc"`
+	Input       string             `json:"input"`
+	Output      string             `json:"output"`
+	Hint        string             `json:"hint"`
+	Source      string             `json:"source"`
+	TimeLimit   int                `json:"time_limit"`   // ms
+	MemoryLimit int                `json:"memory_limit"` // KB
+	Difficulty  model.Difficulty   `json:"difficulty"`
+	Limit       model.JSON         `json:"limit"`
+	Languages   []int              `json:"languages,omitempty"` // allowed languages, empty means all
+	Catalog     string             `json:"catalog"`
+	Tags        []string           `json:"tags"`
+	Samples     []PackageCaseFiles `json:"samples"`
+	TestCases   []PackageCaseFiles `json:"test_cases"`
+	Checker     *PackageChecker    `json:"checker,omitempty"`
+	Type        model.ProblemType  `json:"type"`
+	Interactor  *PackageInteractor `json:"interactor,omitempty"`
+}
+
+// path of input and output file in zip
+type PackageCaseFiles struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	Weight int    `json:"weight,omitempty"` // only for test case
+}
+
+type PackageChecker struct {
+	Type           model.CheckerType `json:"type"`
+	FloatTolerance float64           `json:"float_tolerance,omitempty"`
+	Source         string            `json:"source,omitempty"` // path of source file in zip, only for special checker
+	Language       int               `json:"language"`
+}
+
+type PackageInteractor struct {
+	Source   string `json:"source"` // path of source file in zip
+	Language int    `json:"language"`
+}
+
+type ImportProblemArg struct {
+	File       *multipart.FileHeader `form:"file" binding:"required"`
+	Format     string                `form:"format" binding:"omitempty,oneof=killoj fps"`
+	CatalogID  int                   `form:"catalog_id"` // used when catalog of package not exist
+	BelongType model.BelongType      `form:"belong_type" binding:"omitempty,oneof=0 1 2"`
+	BelongToID int                   `form:"belong_to_id"`
+}
+
+// HUSTOJ free problem set(FPS) xml,
+// only fields used by killoj are parsed
+type FPS struct {
+	XMLName xml.Name  `xml:"fps"`
+	Items   []FPSItem `xml:"item"`
+}
+
+type FPSItem struct {
+	Title         string   `xml:"title"`
+	TimeLimit     FPSLimit `xml:"time_limit"`
+	MemoryLimit   FPSLimit `xml:"memory_limit"`
+	Description   string   `xml:"description"`
+	Input         string   `xml:"input"`
+	Output        string   `xml:"output"`
+	SampleInputs  []string `xml:"sample_input"`
+	SampleOutputs []string `xml:"sample_output"`
+	TestInputs    []string `xml:"test_input"`
+	TestOutputs   []string `xml:"test_output"`
+	Hint          string   `xml:"hint"`
+	Source        string   `xml:"source"`
+}
+
+type FPSLimit struct {
+	Unit  string  `xml:"unit,attr"`
+	Value float64 `xml:",chardata"`
+}
@@ -0,0 +1,52 @@
+package data
+
+import "github.com/si9ma/KillOJ-common/model"
+
+// state of problem saved in update log,
+// inline test data is saved to store, so that only keys and checksums are kept,
+// revisions saved before may still contain inline test data
+type ProblemSnapshot struct {
+	Name               string                  `json:"name"`
+	Desc               string                  `json:"desc"`
+	Input              string                  `json:"input"`
+	Output             string                  `json:"output"`
+	Hint               string                  `json:"hint"`
+	Source             string                  `json:"source"`
+	TimeLimit          int                     `json:"time_limit"`
+	MemoryLimit        int                     `json:"memory_limit"`
+	Difficulty         model.Difficulty        `json:"difficulty"`
+	CatalogID          int                     `json:"catalog_id"`
+	Limit              model.JSON              `json:"limit"`
+	AllowedLanguages   model.IntSlice          `json:"allowed_languages"`
+	CheckerType        model.CheckerType       `json:"checker_type"`
+	FloatTolerance     float64                 `json:"float_tolerance"`
+	CheckerSource      string                  `json:"checker_source"`
+	CheckerLanguage    int                     `json:"checker_language"`
+	Type               model.ProblemType       `json:"type"`
+	InteractorSource   string                  `json:"interactor_source"`
+	InteractorLanguage int                     `json:"interactor_language"`
+	Tags               []string                `json:"tags"`
+	Samples            []model.ProblemSample   `json:"samples"`
+	TestCases          []model.ProblemTestCase `json:"test_cases"`
+}
+
+type RevisionDiffArg struct {
+	From int `form:"from"` // diff with the state before revision To when From is 0
+	To   int `form:"to" binding:"required"`
+}
+
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+type RevisionDiff struct {
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Changes []FieldChange `json:"changes"`
+}
+
+type RollbackArg struct {
+	CommitMsg string `json:"commit_message" binding:"max=255"`
+}
@@ -0,0 +1,24 @@
+package data
+
+const (
+	TagModeAnd = "and" // problem should have all tags
+	TagModeOr  = "or"  // problem should have any one of tags
+
+	SolvedByMe   = "solved"
+	UnsolvedByMe = "unsolved"
+)
+
+// all filters are combined with AND
+type ProblemSearchArg struct {
+	Page         int      `json:"page" form:"page" binding:"omitempty,min=1"`
+	PageSize     int      `json:"page_size" form:"page_size" binding:"required,min=1,max=100"`
+	Cursor       string   `json:"cursor" form:"cursor"`
+	Keyword      string   `json:"q" form:"q" binding:"max=100"` // search in name, description and source, split by whitespace
+	Difficulties []int    `json:"difficulty" form:"difficulty" binding:"omitempty,dive,oneof=0 1 2"`
+	CatalogID    int      `json:"catalog_id" form:"catalog_id"`
+	Tags         []int    `json:"tag" form:"tag"`
+	TagMode      string   `json:"tag_mode" form:"tag_mode" binding:"omitempty,oneof=and or"` // default is or
+	Solved       string   `json:"solved" form:"solved" binding:"omitempty,oneof=solved unsolved"`
+	MinAcRate    *float64 `json:"min_ac_rate" form:"min_ac_rate" binding:"omitempty,min=0,max=1"`
+	MaxAcRate    *float64 `json:"max_ac_rate" form:"max_ac_rate" binding:"omitempty,min=0,max=1"`
+}
@@ -0,0 +1,41 @@
+package data
+
+const (
+	RankPeriodWeek  = "week"
+	RankPeriodMonth = "month"
+	RankPeriodAll   = "all"
+
+	RankOfGroup        = "group"
+	RankOfOrganization = "organization"
+)
+
+type RankArg struct {
+	Page     int    `json:"page" form:"page" binding:"required,min=1"`
+	PageSize int    `json:"page_size" form:"page_size" binding:"required,min=1,max=100"`
+	Period   string `json:"period" form:"period" binding:"omitempty,oneof=week month all"` // default is all
+	Of       string `json:"of" form:"of" binding:"omitempty,oneof=group organization"`     // default is global
+	ID       int    `json:"id" form:"id"`                                                  // id of group
+	Name     string `json:"name" form:"name" binding:"max=50"`                             // name of organization, default is organization of current user
+}
+
+// users are ordered by solved desc, then submit count asc,
+// users with same solved and submit count have same rank
+type RankList struct {
+	Period string     `json:"period"`
+	Total  int        `json:"total"`
+	Rows   []RankItem `json:"rows"`
+}
+
+type RankItem struct {
+	Rank        int      `json:"rank"`
+	User        RankUser `json:"user"`
+	SolvedCount int      `json:"solved_count"`
+	SubmitCount int      `json:"submit_count"`
+}
+
+type RankUser struct {
+	ID           int    `gorm:"column:id" json:"id"`
+	Name         string `gorm:"column:name" json:"name"`
+	Organization string `gorm:"column:organization" json:"organization"`
+	AvatarUrl    string `gorm:"column:avatar_url" json:"avatar"`
+}
@@ -0,0 +1,17 @@
+package data
+
+type RegisterArg struct {
+	TeamName string `json:"team_name" binding:"max=50"` // required when contest is participated in team
+}
+
+type JoinTeamArg struct {
+	JoinCode string `json:"join_code" binding:"required,max=50"`
+}
+
+type ReviewArg struct {
+	Status string `json:"status" binding:"required,oneof=approved rejected"`
+}
+
+type RegistrationListArg struct {
+	Status string `json:"status" form:"status" binding:"omitempty,oneof=pending approved rejected"` // default is all
+}
@@ -0,0 +1,34 @@
+package data
+
+import "time"
+
+// rejudge task stored in redis
+type RejudgeTask struct {
+	ID        string        `json:"id"`
+	CreatorID int           `json:"creator_id"`
+	CreatedAt time.Time     `json:"created_at"`
+	Submits   []RejudgeItem `json:"submits"`
+}
+
+type RejudgeItem struct {
+	SubmitID  int `json:"submit_id"`
+	UserID    int `json:"user_id"`
+	ProblemID int `json:"problem_id"`
+	OldResult int `json:"old_result"`
+}
+
+type RejudgeProgress struct {
+	ID         string          `json:"id"`
+	Total      int             `json:"total"`
+	Completed  int             `json:"completed"`
+	IsComplete bool            `json:"is_complete"`
+	Changes    []VerdictChange `json:"changes"` // only completed submits
+}
+
+type VerdictChange struct {
+	SubmitID  int `json:"submit_id"`
+	UserID    int `json:"user_id"`
+	ProblemID int `json:"problem_id"`
+	OldResult int `json:"old_result"`
+	NewResult int `json:"new_result"`
+}
@@ -0,0 +1,46 @@
+package data
+
+import (
+	"time"
+
+	"github.com/si9ma/KillOJ-common/model"
+)
+
+type Scoreboard struct {
+	ContestID int               `json:"contest_id"`
+	ScoreMode model.ScoreMode   `json:"score_mode"`
+	StartTime time.Time         `json:"start_time"`
+	EndTime   time.Time         `json:"end_time"`
+	IsFrozen  bool              `json:"is_frozen"`
+	FrozenAt  *time.Time        `json:"frozen_at,omitempty"` // only exist when contest has frozen time
+	Problems  []ScoreboardProb  `json:"problems"`
+	Rows      []ScoreboardEntry `json:"rows"`
+}
+
+type ScoreboardProb struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	SolvedCount int    `json:"solved_count"`
+	TriedCount  int    `json:"tried_count"`
+}
+
+type ScoreboardEntry struct {
+	Rank      int                `json:"rank"`
+	User      model.User         `json:"user"` // leader of team when entry is team
+	Team      *model.Team        `json:"team,omitempty"`
+	Solved    int                `json:"solved"`
+	Penalty   int                `json:"penalty"` // minute, only for ACM mode
+	Score     int                `json:"score"`   // only for OI mode
+	Problems  []ProblemScoreCell `json:"problems"`
+	IsVirtual bool               `json:"is_virtual"` // ghost entry of virtual participation
+}
+
+type ProblemScoreCell struct {
+	ProblemID    int  `json:"problem_id"`
+	Attempts     int  `json:"attempts"`      // wrong attempts before first accepted in ACM mode, all attempts in OI mode
+	Score        int  `json:"score"`         // only for OI mode, 0 ~ 100
+	PendingCount int  `json:"pending_count"` // submits after scoreboard frozen
+	IsAccepted   bool `json:"is_accepted"`
+	AcceptedAt   int  `json:"accepted_at"` // minute from contest start
+	IsFirstBlood bool `json:"is_first_blood"`
+}
@@ -3,17 +3,20 @@ package data
 
 import "github.com/si9ma/KillOJ-common/model"
 
+// password is hashed before saved, and should be cleared before return
 type GroupInviteData struct {
-	ID       string `json:"id"`
-	GroupID  int    `json:"group_id"`
-	Password string `json:"password,omitempty" binding:"max=30"`
-	Timeout  int    `json:"timeout" binding:"required,min=3600,max=2592000"` // second , max = 30 day,min = a hour
+	ID          string `json:"id"`
+	GroupID     int    `json:"group_id"`
+	Password    string `json:"password,omitempty" binding:"max=30"`
+	HasPassword bool   `json:"has_password" binding:"-"`
+	Timeout     int    `json:"timeout" binding:"required,min=3600,max=2592000"` // second , max = 30 day,min = a hour
 }
 
 type ContestInviteData struct {
 	ID          string `json:"id"`
 	ContestID   int    `json:"contest_id"`
 	Password    string `json:"password,omitempty" binding:"max=30"`
+	HasPassword bool   `json:"has_password" binding:"-"`
 	AllowGroups []int  `json:"allow_groups"`
 }
 
@@ -29,10 +32,29 @@ type ContestWrap struct {
 	Password     string `json:"-"`
 }
 
+// status of problem for current user
+const (
+	ProblemAccepted  = "accepted"
+	ProblemAttempted = "attempted"
+	ProblemUntouched = "untouched"
+)
+
+type ProblemStats struct {
+	SubmitCount   int     `json:"submit_count"`
+	AcceptedCount int     `json:"accepted_count"`
+	AcceptedRatio float64 `json:"accepted_ratio"`
+}
+
+type ProblemWrap struct {
+	model.Problem
+	MyStatus string       `json:"my_status"`
+	Stats    ProblemStats `json:"stats"`
+}
+
 type SubmitArg struct {
 	ProblemID  int
-	SourceCode string `json:"source_code" binding:"required"`
-	Language   int    `json:"language" binding:"exists,oneof=0 1 2 3"`
+	SourceCode string `json:"source_code" binding:"required,max=65535"` // source code is saved in TEXT column
+	Language   int    `json:"language" binding:"exists,language"`
 }
 
 type CommentArg struct {
@@ -41,3 +63,34 @@ type CommentArg struct {
 	ForComment int    `json:"for_comment" binding:"exists,min=0"`
 	ToID       int    `json:"to_id" binding:"exists,min=0"`
 }
+
+// reference of test case for judger,
+// empty key means test data is stored inline in db
+type TestCaseRef struct {
+	ID        int    `json:"id"`
+	InputKey  string `json:"input_key"`
+	InputSum  string `json:"input_sha256"`
+	OutputKey string `json:"output_key"`
+	OutputSum string `json:"output_sha256"`
+	Weight    int    `json:"weight"`
+}
+
+// result of cleaning unreferenced test data in store
+type TestDataCleanResult struct {
+	Checked int `json:"checked"`
+	Removed int `json:"removed"`
+}
+
+// checker config for judger
+type CheckerConfig struct {
+	Type           model.CheckerType `json:"type"`
+	FloatTolerance float64           `json:"float_tolerance,omitempty"`
+	Source         string            `json:"source,omitempty"`
+	Language       int               `json:"language"`
+}
+
+// interactor config for judger, only for interactive problem
+type InteractorConfig struct {
+	Source   string `json:"source"`
+	Language int    `json:"language"`
+}
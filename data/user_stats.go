@@ -0,0 +1,54 @@
+package data
+
+import (
+	"time"
+
+	"github.com/si9ma/KillOJ-common/model"
+)
+
+// statistics of complete submits of user
+type UserStats struct {
+	UserID             int               `json:"user_id"`
+	SubmitCount        int               `json:"submit_count"`
+	SolvedCount        int               `json:"solved_count"`
+	SolvedByDifficulty []DifficultyCount `json:"solved_by_difficulty"`
+	SolvedByTag        []TagCount        `json:"solved_by_tag"`
+	Verdicts           []VerdictCount    `json:"verdicts"`
+	Languages          []LanguageCount   `json:"languages"`
+	Heatmap            []DailyCount      `json:"heatmap"` // every day of last year, include days without submit
+	RecentAccepted     []AcceptedProblem `json:"recent_accepted"`
+}
+
+type DifficultyCount struct {
+	Difficulty model.Difficulty `json:"difficulty" gorm:"column:difficulty"`
+	Count      int              `json:"count" gorm:"column:count"`
+}
+
+type TagCount struct {
+	TagID int    `json:"tag_id" gorm:"column:tag_id"`
+	Name  string `json:"name" gorm:"column:name"`
+	Count int    `json:"count" gorm:"column:count"`
+}
+
+type VerdictCount struct {
+	Result int    `json:"result" gorm:"column:result"`
+	Msg    string `json:"msg" gorm:"-"`
+	Count  int    `json:"count" gorm:"column:count"`
+}
+
+type LanguageCount struct {
+	Language int    `json:"language" gorm:"column:language"`
+	Name     string `json:"name" gorm:"-"` // empty when language is removed from registry
+	Count    int    `json:"count" gorm:"column:count"`
+}
+
+type DailyCount struct {
+	Date  string `json:"date" gorm:"column:date"` // yyyy-mm-dd
+	Count int    `json:"count" gorm:"column:count"`
+}
+
+type AcceptedProblem struct {
+	ProblemID  int       `json:"problem_id" gorm:"column:problem_id"`
+	Name       string    `json:"name" gorm:"column:name"`
+	AcceptedAt time.Time `json:"accepted_at" gorm:"column:accepted_at"`
+}
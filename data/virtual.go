@@ -0,0 +1,7 @@
+package data
+
+import "time"
+
+type VirtualArg struct {
+	StartTime *time.Time `json:"start_time" binding:"omitempty,gte"` // default is now
+}
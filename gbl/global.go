@@ -3,8 +3,10 @@ package gbl
 
 import (
 	"io"
+	"net"
 
 	"github.com/RichardKnop/machinery/v1"
+	"github.com/si9ma/KillOJ-backend/store"
 
 	"github.com/go-redis/redis"
 
@@ -26,3 +28,12 @@ var TracerCloser io.Closer
 
 // asyncjob server
 var MachineryServer *machinery.Server
+
+// test data store
+var Store store.Store
+
+// max size of test data uploaded to store
+var MaxTestDataSize int64 = store.DefaultMaxSize
+
+// reverse proxies whose forwarded headers are trusted
+var TrustedProxies []*net.IPNet
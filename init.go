@@ -9,6 +9,8 @@ import (
 	"github.com/si9ma/KillOJ-common/kredis"
 
 	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/language"
+	"github.com/si9ma/KillOJ-backend/store"
 
 	"github.com/opentracing/opentracing-go"
 	"github.com/si9ma/KillOJ-common/mysql"
@@ -85,5 +87,24 @@ func Init(cfgPath string) (cfg *config.Config, err error) {
 		return nil, err
 	}
 
+	// init language registry
+	if err = language.Init(cfg.Languages); err != nil {
+		log.Bg().Error("Init languages fail", zap.Error(err))
+		return nil, err
+	}
+
+	// init test data store
+	if gbl.Store, err = store.Init(cfg.Store); err != nil {
+		log.Bg().Error("Init store fail", zap.Error(err))
+		return nil, err
+	}
+	gbl.MaxTestDataSize = cfg.Store.MaxDataSize()
+
+	// init trusted proxies
+	if gbl.TrustedProxies, err = cfg.App.TrustedNets(); err != nil {
+		log.Bg().Error("Init trusted proxies fail", zap.Error(err))
+		return nil, err
+	}
+
 	return cfg, nil
 }
@@ -41,6 +41,11 @@ var (
 	ErrNotComplete                 = ErrResponse{http.StatusBadRequest, 40009, tip.TaskNotCompleteTip, nil}
 	ErrAtLeast                     = ErrResponse{http.StatusBadRequest, 40010, tip.AtLeastTip, nil}
 	ErrHaveRunningTask             = ErrResponse{http.StatusBadRequest, 40011, tip.HaveRunningTaskTip, nil}
+	ErrInvalidPackage              = ErrResponse{http.StatusBadRequest, 40012, tip.InvalidPackageTip, nil}
+	ErrLanguageNotAllowed          = ErrResponse{http.StatusBadRequest, 40013, tip.LanguageNotAllowedTip, nil}
+	ErrContestNotEnded             = ErrResponse{http.StatusBadRequest, 40014, tip.ContestNotEndedTip, nil}
+	ErrContestFull                 = ErrResponse{http.StatusBadRequest, 40015, tip.ContestFullTip, nil}
+	ErrTeamFull                    = ErrResponse{http.StatusBadRequest, 40016, tip.TeamFullTip, nil}
 
 	// 401xx:
 	ErrUnauthorizedGeneral = ErrResponse{http.StatusUnauthorized, 40100, tip.UnauthorizedGeneralTip, nil}
@@ -51,13 +56,21 @@ var (
 	ErrNotSupportProvider  = ErrResponse{http.StatusUnauthorized, 40105, tip.NotSupportProviderTip, nil}
 
 	// 403xx : forbidden
-	ErrForbiddenGeneral = ErrResponse{http.StatusForbidden, 40300, tip.ForbiddenTip, nil}
+	ErrForbiddenGeneral   = ErrResponse{http.StatusForbidden, 40300, tip.ForbiddenTip, nil}
+	ErrContestNotStarted  = ErrResponse{http.StatusForbidden, 40301, tip.ContestNotStartedTip, nil}
+	ErrRegistrationClosed = ErrResponse{http.StatusForbidden, 40302, tip.RegistrationClosedTip, nil}
 
 	// 404xx : not found
 	ErrNotFoundGeneral     = ErrResponse{http.StatusNotFound, 40400, tip.NotFoundTip, nil}
 	ErrNotFound            = ErrResponse{http.StatusNotFound, 40401, tip.NotExistTip, nil}
 	ErrNotFoundOrOutOfDate = ErrResponse{http.StatusNotFound, 40401, tip.NotExistOrOutOfDateTip, nil}
 
+	// 413xx : request entity too large
+	ErrTooLarge = ErrResponse{http.StatusRequestEntityTooLarge, 41300, tip.TooLargeTip, nil}
+
+	// 429xx : too many requests
+	ErrTooManyAttempts = ErrResponse{http.StatusTooManyRequests, 42900, tip.TooManyAttemptsTip, nil}
+
 	// 500xx: Internal Server Error
 	ErrInternalServerErrorGeneral = ErrResponse{http.StatusInternalServerError, 50000, tip.InternalServerErrorTip, nil}
 )
@@ -0,0 +1,129 @@
+// registry of languages supported by judger
+package language
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type Language struct {
+	ID           int     `yaml:"id" json:"id"`
+	Name         string  `yaml:"name" json:"name"`
+	Compiler     string  `yaml:"compiler" json:"compiler"`      // compiler or interpreter with version, eg: gcc 8.3.0
+	SourceFile   string  `yaml:"sourceFile" json:"source_file"` // file name of source code in sandbox
+	CompileCmd   string  `yaml:"compileCmd" json:"compile_cmd"` // empty for interpreted language
+	RunCmd       string  `yaml:"runCmd" json:"run_cmd"`
+	Template     string  `yaml:"template" json:"template"`          // default source template
+	TimeFactor   float64 `yaml:"timeFactor" json:"time_factor"`     // multiplier of time limit, default 1
+	MemoryFactor float64 `yaml:"memoryFactor" json:"memory_factor"` // multiplier of memory limit, default 1
+}
+
+// time limit and memory limit for this language
+func (l Language) Limit(timeLimit int, memoryLimit int) (int, int) {
+	return int(float64(timeLimit) * l.TimeFactor), int(float64(memoryLimit) * l.MemoryFactor)
+}
+
+// languages supported by default, id should be compatible with old data
+var defaultLanguages = []Language{
+	{
+		ID:         0,
+		Name:       "C",
+		Compiler:   "gcc",
+		SourceFile: "main.c",
+		CompileCmd: "gcc -O2 -std=c11 -o Main main.c -lm",
+		RunCmd:     "./Main",
+	},
+	{
+		ID:         1,
+		Name:       "C++",
+		Compiler:   "g++",
+		SourceFile: "main.cpp",
+		CompileCmd: "g++ -O2 -std=c++11 -o Main main.cpp",
+		RunCmd:     "./Main",
+	},
+	{
+		ID:           2,
+		Name:         "Java",
+		Compiler:     "openjdk",
+		SourceFile:   "Main.java",
+		CompileCmd:   "javac Main.java",
+		RunCmd:       "java Main",
+		TimeFactor:   2,
+		MemoryFactor: 2,
+	},
+	{
+		ID:         3,
+		Name:       "Go",
+		Compiler:   "go",
+		SourceFile: "main.go",
+		CompileCmd: "go build -o Main main.go",
+		RunCmd:     "./Main",
+	},
+}
+
+var (
+	mu        sync.RWMutex
+	languages map[int]Language
+)
+
+func init() {
+	_ = Init(nil)
+}
+
+// init registry, use default languages when langs is empty
+func Init(langs []Language) error {
+	if len(langs) == 0 {
+		langs = defaultLanguages
+	}
+
+	registry := make(map[int]Language)
+	for _, l := range langs {
+		if _, ok := registry[l.ID]; ok {
+			return fmt.Errorf("duplicate language id %d", l.ID)
+		}
+		if l.Name == "" || l.SourceFile == "" || l.RunCmd == "" {
+			return fmt.Errorf("name, sourceFile and runCmd of language %d must not be empty", l.ID)
+		}
+		if l.TimeFactor <= 0 {
+			l.TimeFactor = 1
+		}
+		if l.MemoryFactor <= 0 {
+			l.MemoryFactor = 1
+		}
+		registry[l.ID] = l
+	}
+
+	mu.Lock()
+	languages = registry
+	mu.Unlock()
+	return nil
+}
+
+func Get(id int) (Language, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	l, ok := languages[id]
+	return l, ok
+}
+
+func Exist(id int) bool {
+	_, ok := Get(id)
+	return ok
+}
+
+// all languages, sorted by id
+func All() []Language {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var res []Language
+	for _, l := range languages {
+		res = append(res, l)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
@@ -0,0 +1,34 @@
+package language
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInit(t *testing.T) {
+	defer Init(nil)
+
+	// default languages
+	assert.True(t, Exist(0))
+	assert.False(t, Exist(4))
+
+	err := Init([]Language{
+		{ID: 4, Name: "Python 3", SourceFile: "main.py", RunCmd: "python3 main.py", TimeFactor: 3},
+	})
+	assert.NoError(t, err)
+	assert.False(t, Exist(0))
+
+	python, ok := Get(4)
+	assert.True(t, ok)
+	timeLimit, memoryLimit := python.Limit(1000, 65536)
+	assert.Equal(t, 3000, timeLimit)
+	assert.Equal(t, 65536, memoryLimit)
+
+	// duplicate id
+	err = Init([]Language{
+		{ID: 1, Name: "C++", SourceFile: "main.cpp", RunCmd: "./Main"},
+		{ID: 1, Name: "C", SourceFile: "main.c", RunCmd: "./Main"},
+	})
+	assert.Error(t, err)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/si9ma/KillOJ-backend/config"
 
 	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/srv"
 
 	"github.com/si9ma/KillOJ-common/log"
 	"github.com/urfave/cli"
@@ -40,6 +41,9 @@ func init() {
 			return err
 		}
 
+		// collect judge result and update rank in background
+		srv.StartJudgeCollector()
+
 		// setup Router
 		r := setupRouter(cfg)
 		if err := r.Run(cfg.App.Addr()); err != nil {
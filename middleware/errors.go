@@ -40,6 +40,8 @@ func validationErrorToText(e *validator.FieldError) string {
 		return fmt.Sprintf(tip.OneOfTip.String(), word, e.Param)
 	case "requiredwhenfield":
 		return fmt.Sprintf(tip.RequiredWhenFieldNotEmptyTip.String(), e.Param, word)
+	case "requiredwhenfieldempty":
+		return fmt.Sprintf(tip.RequiredWhenFieldEmptyTip.String(), e.Param, word)
 
 	// excludes
 	case "excludesrune":
@@ -0,0 +1,3 @@
+-- user-001: scoreboard freeze of contest
+ALTER TABLE `contest`
+    ADD COLUMN `frozen_time` int(11) NOT NULL DEFAULT 0 COMMENT 'minutes before end time to freeze scoreboard, 0 means never freeze';
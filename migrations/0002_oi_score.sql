@@ -0,0 +1,11 @@
+-- user-002: OI style partial scoring
+ALTER TABLE `contest`
+    ADD COLUMN `score_mode` tinyint(4) NOT NULL DEFAULT 0 COMMENT '0: ACM, 1: OI best, 2: OI last';
+
+ALTER TABLE `problem_test_case`
+    ADD COLUMN `weight` int(11) NOT NULL DEFAULT 0 COMMENT 'score weight in OI mode, 0 is treated as 1';
+
+ALTER TABLE `submit`
+    ADD COLUMN `passed_cases` json DEFAULT NULL COMMENT 'id of passed test cases, only for full judge',
+    ADD COLUMN `passed_num` int(11) NOT NULL DEFAULT 0,
+    ADD COLUMN `case_num` int(11) NOT NULL DEFAULT 0;
@@ -0,0 +1,8 @@
+-- user-004: judge result detail of submit
+CREATE TABLE `submit_result` (
+    `submit_id` int(11) NOT NULL,
+    `created_at` datetime DEFAULT NULL,
+    `updated_at` datetime DEFAULT NULL,
+    `detail` json DEFAULT NULL,
+    PRIMARY KEY (`submit_id`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,10 @@
+-- user-007: large test data is saved in test data store
+ALTER TABLE `problem_test_case`
+    ADD COLUMN `input_key` varchar(255) NOT NULL DEFAULT '' COMMENT 'key of input in test data store',
+    ADD COLUMN `input_size` bigint(20) NOT NULL DEFAULT 0,
+    ADD COLUMN `input_sum` char(64) NOT NULL DEFAULT '' COMMENT 'sha256 of input',
+    ADD COLUMN `output_key` varchar(255) NOT NULL DEFAULT '' COMMENT 'key of expected output in test data store',
+    ADD COLUMN `output_size` bigint(20) NOT NULL DEFAULT 0,
+    ADD COLUMN `output_sum` char(64) NOT NULL DEFAULT '' COMMENT 'sha256 of expected output',
+    ADD INDEX `idx_input_key` (`input_key`),
+    ADD INDEX `idx_output_key` (`output_key`);
@@ -0,0 +1,6 @@
+-- user-008: checker of problem
+ALTER TABLE `problem`
+    ADD COLUMN `checker_type` tinyint(4) NOT NULL DEFAULT 0 COMMENT '0: exact, 1: ignore whitespace, 2: float, 3: special',
+    ADD COLUMN `float_tolerance` double NOT NULL DEFAULT 0,
+    ADD COLUMN `checker_source` mediumtext,
+    ADD COLUMN `checker_language` int(11) NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+-- user-009: interactive problem
+ALTER TABLE `problem`
+    ADD COLUMN `type` tinyint(4) NOT NULL DEFAULT 0 COMMENT '0: traditional, 1: interactive',
+    ADD COLUMN `interactor_source` mediumtext,
+    ADD COLUMN `interactor_language` int(11) NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+-- user-010: playground snippets with history
+ALTER TABLE `playground`
+    ADD COLUMN `created_at` datetime DEFAULT NULL,
+    ADD COLUMN `updated_at` datetime DEFAULT NULL;
+
+ALTER TABLE `playground_history`
+    ADD COLUMN `created_at` datetime DEFAULT NULL,
+    ADD COLUMN `language` int(11) NOT NULL DEFAULT 0,
+    ADD INDEX `idx_playground_id` (`playground_id`);
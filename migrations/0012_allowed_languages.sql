@@ -0,0 +1,6 @@
+-- user-012: allowed languages of problem and contest, empty means all languages are allowed
+ALTER TABLE `problem`
+    ADD COLUMN `allowed_languages` json DEFAULT NULL;
+
+ALTER TABLE `contest`
+    ADD COLUMN `allowed_languages` json DEFAULT NULL;
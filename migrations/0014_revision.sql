@@ -0,0 +1,6 @@
+-- user-014: revisions of problem, snapshots may be large
+ALTER TABLE `problem_update_log`
+    ADD COLUMN `created_at` datetime DEFAULT NULL,
+    MODIFY COLUMN `before_log` longtext,
+    MODIFY COLUMN `after_log` longtext,
+    ADD INDEX `idx_problem_id` (`problem_id`);
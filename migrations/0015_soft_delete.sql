@@ -0,0 +1,12 @@
+-- user-015: archived problem, contest and group
+ALTER TABLE `problem`
+    ADD COLUMN `deleted_at` datetime DEFAULT NULL,
+    ADD INDEX `idx_deleted_at` (`deleted_at`);
+
+ALTER TABLE `contest`
+    ADD COLUMN `deleted_at` datetime DEFAULT NULL,
+    ADD INDEX `idx_deleted_at` (`deleted_at`);
+
+ALTER TABLE `group`
+    ADD COLUMN `deleted_at` datetime DEFAULT NULL,
+    ADD INDEX `idx_deleted_at` (`deleted_at`);
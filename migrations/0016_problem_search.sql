@@ -0,0 +1,20 @@
+-- user-016: search of problems
+-- keywords are matched by FULLTEXT index, ngram parser is required for CJK text,
+-- search falls back to LIKE when the index doesn't exist
+ALTER TABLE `problem`
+    ADD FULLTEXT INDEX `ft_problem_text` (`name`, `desc`, `source`) WITH PARSER ngram;
+
+-- precomputed count of complete submits of problem, for filtering by accepted ratio
+CREATE TABLE `problem_stat` (
+    `problem_id` int(11) NOT NULL,
+    `submit_count` int(11) NOT NULL DEFAULT 0,
+    `accepted_count` int(11) NOT NULL DEFAULT 0,
+    PRIMARY KEY (`problem_id`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+-- backfill, result 0 is accepted
+INSERT INTO `problem_stat` (`problem_id`, `submit_count`, `accepted_count`)
+SELECT `problem_id`, count(*), sum(`result` = 0)
+FROM `submit`
+WHERE `is_complete` = 1
+GROUP BY `problem_id`;
@@ -0,0 +1,3 @@
+-- user-021: submit to problem of contest after the contest ended
+ALTER TABLE `submit`
+    ADD COLUMN `out_of_contest` tinyint(1) NOT NULL DEFAULT 0;
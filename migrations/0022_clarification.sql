@@ -0,0 +1,16 @@
+-- user-022: clarifications and announcements of contest
+CREATE TABLE `clarification` (
+    `id` int(11) NOT NULL AUTO_INCREMENT,
+    `created_at` datetime DEFAULT NULL,
+    `updated_at` datetime DEFAULT NULL,
+    `contest_id` int(11) NOT NULL,
+    `problem_id` int(11) NOT NULL DEFAULT 0 COMMENT '0 means the whole contest',
+    `from_id` int(11) NOT NULL,
+    `question` text,
+    `answer` text,
+    `answered_at` datetime DEFAULT NULL,
+    `is_public` tinyint(1) NOT NULL DEFAULT 0,
+    `is_announcement` tinyint(1) NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    KEY `idx_contest_id` (`contest_id`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
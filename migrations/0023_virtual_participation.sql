@@ -0,0 +1,11 @@
+-- user-023: virtual participation of ended contest
+CREATE TABLE `virtual_participation` (
+    `id` int(11) NOT NULL AUTO_INCREMENT,
+    `created_at` datetime DEFAULT NULL,
+    `contest_id` int(11) NOT NULL,
+    `user_id` int(11) NOT NULL,
+    `start_time` datetime NOT NULL,
+    `end_time` datetime NOT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_contest_user` (`contest_id`, `user_id`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
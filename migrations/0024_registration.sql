@@ -0,0 +1,38 @@
+-- user-024: registration of contest
+ALTER TABLE `contest`
+    ADD COLUMN `register_mode` tinyint(4) NOT NULL DEFAULT 0 COMMENT '0: invite, 1: public, 2: approval',
+    ADD COLUMN `register_deadline` datetime DEFAULT NULL COMMENT 'default is end time',
+    ADD COLUMN `max_participants` int(11) NOT NULL DEFAULT 0 COMMENT '0 means no limit',
+    ADD COLUMN `max_team_size` int(11) NOT NULL DEFAULT 0 COMMENT 'participate in team when greater than 1';
+
+CREATE TABLE `team` (
+    `id` int(11) NOT NULL AUTO_INCREMENT,
+    `contest_id` int(11) NOT NULL,
+    `name` varchar(50) NOT NULL,
+    `leader_id` int(11) NOT NULL,
+    `join_code` varchar(36) NOT NULL,
+    `created_at` datetime DEFAULT NULL,
+    `updated_at` datetime DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_contest_join_code` (`contest_id`, `join_code`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+CREATE TABLE `team_member` (
+    `team_id` int(11) NOT NULL,
+    `user_id` int(11) NOT NULL,
+    PRIMARY KEY (`team_id`, `user_id`),
+    KEY `idx_user_id` (`user_id`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+CREATE TABLE `contest_registration` (
+    `id` int(11) NOT NULL AUTO_INCREMENT,
+    `contest_id` int(11) NOT NULL,
+    `user_id` int(11) NOT NULL,
+    `team_id` int(11) NOT NULL DEFAULT 0 COMMENT '0 means individual registration',
+    `status` varchar(16) NOT NULL COMMENT 'pending, approved or rejected',
+    `created_at` datetime DEFAULT NULL,
+    `updated_at` datetime DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    KEY `idx_contest_status` (`contest_id`, `status`),
+    KEY `idx_team_id` (`team_id`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -10,6 +10,7 @@ import (
 	"github.com/si9ma/KillOJ-common/log"
 	"github.com/si9ma/KillOJ-common/mysql"
 
+	"github.com/si9ma/KillOJ-backend/data"
 	"github.com/si9ma/KillOJ-backend/gbl"
 
 	"github.com/gin-gonic/gin"
@@ -18,21 +19,28 @@ import (
 	otgrom "github.com/smacker/opentracing-gorm"
 )
 
-func GetAllCatalogs(c *gin.Context, page, pageSize int, order string) ([]model.Catalog, error) {
+func GetAllCatalogs(c *gin.Context, spec *data.PageSpec) (*data.PageResult, error) {
 	var err error
 
 	ctx := c.Request.Context()
 	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
-	offset := (page - 1) * pageSize
 
 	var catalogs []model.Catalog
 
-	if order != "" {
-		err = db.Model(&model.Catalog{}).Order(order).Offset(offset).Limit(pageSize).Find(&catalogs).Error
-	} else {
-		err = db.Model(&model.Catalog{}).Offset(offset).Limit(pageSize).Find(&catalogs).Error
+	if err := CheckSort(c, spec.Sorts, catalogSortFields); err != nil {
+		return nil, err
+	}
+
+	total := 0
+	err = db.Model(&model.Catalog{}).Count(&total).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"count catalogs", nil) != mysql.Success {
+		return nil, err
 	}
 
+	err = OrderBy(db.Model(&model.Catalog{}), spec.Sorts, catalogSortFields).
+		Offset(spec.Offset).Limit(spec.Limit).Find(&catalogs).Error
+
 	// error handle
 	if mysql.ErrorHandleAndLog(c, err, true,
 		"get catalogs", nil) != mysql.Success {
@@ -40,7 +48,7 @@ func GetAllCatalogs(c *gin.Context, page, pageSize int, order string) ([]model.C
 	}
 
 	log.For(ctx).Info("success get catalogs")
-	return catalogs, nil
+	return NewPageResult(spec, total, catalogs), nil
 }
 
 func GetCatalog(c *gin.Context, id int) (*model.Catalog, error) {
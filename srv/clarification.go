@@ -0,0 +1,317 @@
+package srv
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/si9ma/KillOJ-backend/auth"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/kerror"
+	"github.com/si9ma/KillOJ-common/kjson"
+	"github.com/si9ma/KillOJ-common/kredis"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/si9ma/KillOJ-common/mysql"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	// redis channel of clarification events of contest
+	ClarificationChannelPrefix = "killoj_contest_clarification_"
+)
+
+// only owner of contest can see all clarifications,
+// participant can see public clarifications and own questions
+func isClarificationVisible(contest *model.Contest, clarification *model.Clarification, userID int) bool {
+	return contest.OwnerID == userID || clarification.IsPublic || clarification.FromID == userID
+}
+
+// problem of clarification should belong to contest, 0 means the whole contest
+func checkProblemOfContest(c *gin.Context, contestID, problemID int) error {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	if problemID == 0 {
+		return nil
+	}
+
+	count := 0
+	err := db.Model(&model.Problem{}).Where("id = ? AND belong_type = ? AND belong_to_id = ?",
+		problemID, model.BelongToContest, contestID).Count(&count).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"check if problem belong to contest", problemID) != mysql.Success {
+		return err
+	}
+
+	if count == 0 {
+		err := fmt.Errorf("problem %d not in contest %d", problemID, contestID)
+		log.For(ctx).Error("problem not in contest", zap.Error(err))
+		_ = c.Error(err).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrNotExist.WithArgs("problem " + strconv.Itoa(problemID)))
+		return err
+	}
+
+	return nil
+}
+
+// clarifications are pushed in best effort, participant can also get them by listing,
+// so fail to publish don't fail the request
+func publishClarification(c *gin.Context, eventType string, clarification *model.Clarification) {
+	ctx := c.Request.Context()
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+
+	event := data.ClarificationEvent{
+		Type:          eventType,
+		Clarification: *clarification,
+	}
+	msg, err := kjson.MarshalString(event)
+	if err != nil {
+		log.For(ctx).Error("marshal clarification event fail", zap.Error(err))
+		return
+	}
+
+	channel := ClarificationChannelPrefix + strconv.Itoa(clarification.ContestID)
+	if err := redisCli.Publish(channel, msg).Err(); err != nil {
+		log.For(ctx).Error("publish clarification event fail", zap.Error(err), zap.String("channel", channel))
+	}
+}
+
+func GetClarifications(c *gin.Context, contestID int) ([]model.Clarification, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	myID := auth.GetUserFromJWT(c).ID
+
+	contest, err := GetContest(c, contestID)
+	if err != nil {
+		return nil, err
+	}
+
+	var clarifications []model.Clarification
+	queryDB := db.Preload("From").Where("contest_id = ?", contestID)
+	if contest.OwnerID != myID {
+		queryDB = queryDB.Where("is_public = ? OR from_id = ?", true, myID)
+	}
+	err = queryDB.Order("id desc").Find(&clarifications).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get clarifications of contest", contestID) != mysql.Success {
+		return nil, err
+	}
+
+	log.For(ctx).Info("success get clarifications", zap.Int("contestId", contestID))
+	return clarifications, nil
+}
+
+// participant can only ask question when contest is running
+func AskClarification(c *gin.Context, arg *data.ClarificationArg) (*model.Clarification, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	myID := auth.GetUserFromJWT(c).ID
+
+	contest, err := GetContest(c, arg.ContestID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkContestStarted(c, contest); err != nil {
+		return nil, err
+	}
+	if contestPhase(contest, time.Now()) == model.ContestEnded {
+		log.For(ctx).Error("contest already finished", zap.Int("contestID", contest.ID))
+		_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrAlreadyFinished)
+		return nil, kerror.EmptyError
+	}
+	if err := checkProblemOfContest(c, arg.ContestID, arg.ProblemID); err != nil {
+		return nil, err
+	}
+
+	clarification := model.Clarification{
+		ContestID: arg.ContestID,
+		ProblemID: arg.ProblemID,
+		FromID:    myID,
+		Question:  arg.Question,
+	}
+	err = db.Create(&clarification).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"save clarification", arg.ContestID) != mysql.Success {
+		return nil, err
+	}
+
+	// query user info
+	err = db.Preload("From").First(&clarification, clarification.ID).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"query clarification after add", clarification.ID) != mysql.Success {
+		return nil, err
+	}
+
+	publishClarification(c, data.ClarificationAsked, &clarification)
+	log.For(ctx).Info("success ask clarification", zap.Int("contestId", arg.ContestID))
+	return &clarification, nil
+}
+
+// only owner of contest can moderate clarifications
+func getClarification4Manage(c *gin.Context, contestID, id int) (*model.Clarification, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	contest, err := GetContest(c, contestID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkContestOwner(c, contest); err != nil {
+		return nil, err
+	}
+
+	clarification := model.Clarification{}
+	err = db.Preload("From").Where("contest_id = ?", contestID).First(&clarification, id).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get clarification", id) != mysql.Success {
+		return nil, err
+	}
+
+	return &clarification, nil
+}
+
+// answer privately or broadcast answer to all participants,
+// answer can be updated
+func AnswerClarification(c *gin.Context, contestID, id int, arg *data.AnswerArg) (*model.Clarification, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	clarification, err := getClarification4Manage(c, contestID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = db.Model(clarification).Updates(map[string]interface{}{
+		"answer":      arg.Answer,
+		"is_public":   arg.IsPublic || clarification.IsAnnouncement,
+		"answered_at": &now,
+	}).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "answer clarification", id) != mysql.Success {
+		return nil, err
+	}
+
+	publishClarification(c, data.ClarificationAnswered, clarification)
+	log.For(ctx).Info("success answer clarification", zap.Int("clarificationId", id))
+	return clarification, nil
+}
+
+func DeleteClarification(c *gin.Context, contestID, id int) error {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	clarification, err := getClarification4Manage(c, contestID, id)
+	if err != nil {
+		return err
+	}
+
+	err = db.Delete(clarification).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "delete clarification", id) != mysql.Success {
+		return err
+	}
+
+	publishClarification(c, data.ClarificationDeleted, clarification)
+	log.For(ctx).Info("success delete clarification", zap.Int("clarificationId", id))
+	return nil
+}
+
+// announcement is pushed to all participants of contest
+func Announce(c *gin.Context, arg *data.AnnouncementArg) (*model.Clarification, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	myID := auth.GetUserFromJWT(c).ID
+
+	contest, err := GetContest(c, arg.ContestID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkContestOwner(c, contest); err != nil {
+		return nil, err
+	}
+	if err := checkProblemOfContest(c, arg.ContestID, arg.ProblemID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	announcement := model.Clarification{
+		ContestID:      arg.ContestID,
+		ProblemID:      arg.ProblemID,
+		FromID:         myID,
+		Answer:         arg.Content,
+		AnsweredAt:     &now,
+		IsPublic:       true,
+		IsAnnouncement: true,
+	}
+	err = db.Create(&announcement).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"save announcement", arg.ContestID) != mysql.Success {
+		return nil, err
+	}
+
+	// query user info
+	err = db.Preload("From").First(&announcement, announcement.ID).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"query announcement after add", announcement.ID) != mysql.Success {
+		return nil, err
+	}
+
+	publishClarification(c, data.ClarificationAnnounced, &announcement)
+	log.For(ctx).Info("success announce", zap.Int("contestId", arg.ContestID))
+	return &announcement, nil
+}
+
+// subscribe clarification events of contest, only events visible to current user are sent,
+// the returned cancel function should be called to stop the subscription
+func SubscribeClarifications(c *gin.Context, contestID int) (<-chan data.ClarificationEvent, func(), error) {
+	ctx := c.Request.Context()
+	myID := auth.GetUserFromJWT(c).ID
+
+	contest, err := GetContest(c, contestID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	channel := ClarificationChannelPrefix + strconv.Itoa(contestID)
+	pubsub := gbl.Redis.Subscribe(channel)
+	if _, err := pubsub.Receive(); err != nil {
+		_ = pubsub.Close()
+		kredis.ErrorHandleAndLog(c, err, true, "subscribe clarifications", channel, contestID)
+		return nil, nil, err
+	}
+
+	events := make(chan data.ClarificationEvent)
+	done := make(chan struct{})
+	go func() {
+		defer close(events)
+		for msg := range pubsub.Channel() {
+			event := data.ClarificationEvent{}
+			if err := kjson.UnmarshalString(msg.Payload, &event); err != nil {
+				log.For(ctx).Error("unmarshal clarification event fail", zap.Error(err))
+				continue
+			}
+			if !isClarificationVisible(contest, &event.Clarification, myID) {
+				continue
+			}
+
+			select {
+			case events <- event:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	cancel := func() {
+		close(done)
+		if err := pubsub.Close(); err != nil {
+			log.For(ctx).Error("close subscription of clarifications fail", zap.Error(err))
+		}
+	}
+
+	log.For(ctx).Info("success subscribe clarifications", zap.Int("contestId", contestID))
+	return events, cancel, nil
+}
@@ -0,0 +1,19 @@
+package srv
+
+import (
+	"testing"
+
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsClarificationVisible(t *testing.T) {
+	contest := &model.Contest{OwnerID: 1}
+	private := &model.Clarification{FromID: 2}
+	public := &model.Clarification{FromID: 2, IsPublic: true}
+
+	assert.True(t, isClarificationVisible(contest, private, 1))
+	assert.True(t, isClarificationVisible(contest, private, 2))
+	assert.False(t, isClarificationVisible(contest, private, 3))
+	assert.True(t, isClarificationVisible(contest, public, 3))
+}
@@ -41,36 +41,48 @@ import (
 
 const (
 	ContestInvitePrefix = "contest_invite_"
+	// allowed groups of invite, kept after invite expire for virtual participation
+	ContestInviteGroupsPrefix = "contest_invite_groups_"
 )
 
-func GetAllContests(c *gin.Context, page, pageSize int, order string) ([]model.Contest, error) {
+func GetAllContests(c *gin.Context, spec *data.PageSpec) (*data.PageResult, error) {
 	var err error
 
 	ctx := c.Request.Context()
 	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
-	offset := (page - 1) * pageSize
 	user := model.User{
 		ID: auth.GetUserFromJWT(c).ID,
 	}
 
-	if order != "" {
-		err = db.Preload("Contests", func(db *gorm.DB) *gorm.DB {
-			return db.Order(order).Offset(offset).Limit(pageSize)
-		}).Preload("Contests.Owner").First(&user).Error
-	} else {
-		err = db.Preload("Contests", func(db *gorm.DB) *gorm.DB {
-			return db.Offset(offset).Limit(pageSize)
-		}).Preload("Contests.Owner").First(&user).Error
+	if err := CheckSort(c, spec.Sorts, contestSortFields); err != nil {
+		return nil, err
+	}
+
+	total := 0
+	err = db.Model(&model.Contest{}).Joins("join user_in_contest on user_in_contest.contest_id = contest.id").
+		Where("user_in_contest.user_id = ?", user.ID).Count(&total).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"count contests", nil) != mysql.Success {
+		return nil, err
 	}
 
+	err = db.Preload("Contests", func(db *gorm.DB) *gorm.DB {
+		return OrderBy(db, spec.Sorts, contestSortFields).Offset(spec.Offset).Limit(spec.Limit)
+	}).Preload("Contests.Owner").First(&user).Error
+
 	// error handle
 	if mysql.ErrorHandleAndLog(c, err, true,
 		"get contests", nil) != mysql.Success {
 		return nil, err
 	}
 
+	now := time.Now()
+	for i := range user.Contests {
+		user.Contests[i].Phase = contestPhase(&user.Contests[i], now)
+	}
+
 	log.For(ctx).Info("success get contests")
-	return user.Contests, nil
+	return NewPageResult(spec, total, user.Contests), nil
 }
 
 func GetContest(c *gin.Context, id int) (*model.Contest, error) {
@@ -95,6 +107,30 @@ func GetContest(c *gin.Context, id int) (*model.Contest, error) {
 		return nil, kerror.EmptyError
 	}
 	contest := user.Contests[0]
+	contest.Phase = contestPhase(&contest, time.Now())
+
+	log.For(ctx).Info("success get contest", zap.Int("contestId", id))
+	return &contest, nil
+}
+
+// get contest including archived contest, for history such as scoreboard,
+// virtual participants can also view history after their virtual participation start
+func getContest4History(c *gin.Context, id int) (*model.Contest, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	myID := auth.GetUserFromJWT(c).ID
+	contest := model.Contest{}
+
+	err := db.Unscoped().Preload("Owner").
+		Where(`exists (select 1 from user_in_contest as uc where uc.contest_id = contest.id and uc.user_id = ?) or
+			exists (select 1 from virtual_participation as vp
+				where vp.contest_id = contest.id and vp.user_id = ? and vp.start_time <= ?)`,
+			myID, myID, time.Now()).
+		First(&contest, id).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get contest", id) != mysql.Success {
+		return nil, err
+	}
+	contest.Phase = contestPhase(&contest, time.Now())
 
 	log.For(ctx).Info("success get contest", zap.Int("contestId", id))
 	return &contest, nil
@@ -149,6 +185,21 @@ func UpdateContest(c *gin.Context, newContest *model.Contest) error {
 		"update contest", newContest.ID) != mysql.Success {
 		return err
 	}
+
+	// zero values are skipped when updating by struct, so update them explicitly
+	err = db.Model(oldContest).Updates(map[string]interface{}{
+		"frozen_time":       newContest.FrozenTime,
+		"score_mode":        newContest.ScoreMode,
+		"allowed_languages": newContest.AllowedLanguages, // empty means all languages are allowed
+		"register_mode":     newContest.RegisterMode,
+		"register_deadline": newContest.RegisterDeadline,
+		"max_participants":  newContest.MaxParticipants,
+		"max_team_size":     newContest.MaxTeamSize,
+	}).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"update zero value fields of contest", newContest.ID) != mysql.Success {
+		return err
+	}
 	log.For(ctx).Info("update contest success", zap.String("contest", newContest.Name))
 
 	return nil
@@ -196,31 +247,52 @@ func checkContestOwner(c *gin.Context, contest *model.Contest) error {
 	return nil
 }
 
-//func DeleteContest(c *gin.Context, id int) error {
-//	ctx := c.Request.Context()
-//	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
-//
-//	// check if contest exist
-//	contest, err := GetContest(c, id)
-//	if err != nil {
-//		return err
-//	}
-//
-//	// check owner
-//	if err := checkGroupOwner(c, contest); err != nil {
-//		return err
-//	}
-//	// todo should check have problem under this contest
-//
-//	err = db.Delete(&contest).Error
-//	if mysql.ErrorHandleAndLog(c, err, true,
-//		"delete contest", id) != mysql.Success {
-//		return err
-//	}
-//	log.For(ctx).Info("delete contest success", zap.Int("contestId", id))
-//
-//	return nil
-//}
+// archive contest, problems and submits of contest are kept
+func DeleteContest(c *gin.Context, id int) error {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	// only owner and administrator can delete contest
+	contest, err := getContest4Manage(c, id)
+	if err != nil {
+		return err
+	}
+
+	err = db.Delete(contest).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"delete contest", id) != mysql.Success {
+		return err
+	}
+	log.For(ctx).Info("delete contest success", zap.Int("contestId", id))
+
+	return nil
+}
+
+// restore archived contest, only for administrator
+func RestoreContest(c *gin.Context, id int) error {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	contest := model.Contest{}
+	err := db.Unscoped().Where("deleted_at is not null").First(&contest, id).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get archived contest", id) != mysql.Success {
+		return err
+	}
+
+	// name may be used by another contest after archived
+	if !contestCheckUnique(c, &model.Contest{}, &contest) {
+		return fmt.Errorf("check unique fail")
+	}
+
+	err = db.Unscoped().Model(&contest).Update("deleted_at", nil).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"restore contest", id) != mysql.Success {
+		return err
+	}
+	log.For(ctx).Info("restore contest success", zap.Int("contestId", id))
+
+	return nil
+}
 
 // check if user have these group Permission
 func CheckPermission(c *gin.Context, groups []int, anyOne bool) error {
@@ -355,6 +427,12 @@ func Invite2Contest(c *gin.Context, inviteData *data.ContestInviteData) (err err
 	}
 	inviteData.ID = uuid.String()
 
+	// only hash of password is saved
+	inviteData.HasPassword = inviteData.Password != ""
+	if inviteData.Password, err = hashInvitePassword(c, inviteData.Password); err != nil {
+		return err
+	}
+
 	// save invite data to redis
 	res, err := kjson.MarshalString(inviteData)
 	if err != nil {
@@ -382,6 +460,24 @@ func Invite2Contest(c *gin.Context, inviteData *data.ContestInviteData) (err err
 		return err
 	}
 
+	// members of allowed groups can start virtual participation after contest end
+	if len(inviteData.AllowGroups) != 0 {
+		groups, err := kjson.MarshalString(inviteData.AllowGroups)
+		if err != nil {
+			log.For(ctx).Error("marshal json fail", zap.Error(err),
+				zap.Int("contestID", inviteData.ContestID))
+
+			wrap.SetInternalServerError(c, err)
+			return err
+		}
+		k3 := ContestInviteGroupsPrefix + strconv.Itoa(inviteData.ContestID)
+		err = redisCli.Set(k3, groups, 0).Err()
+		if res := kredis.ErrorHandleAndLog(c, err, true,
+			"save allowed groups of contest invite", k3, nil); res != kredis.Success {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -403,6 +499,7 @@ func GetContestInviteData(c *gin.Context, inviteId string) (*data.ContestInviteD
 		wrap.SetInternalServerError(c, err)
 		return nil, err
 	}
+	inviteData.HasPassword = inviteData.Password != "" // invite created before hashing don't have this field
 
 	return &inviteData, nil
 }
@@ -424,6 +521,8 @@ func JoinContestQuery(c *gin.Context, inviteId string) (*data.ContestWrap, error
 		return nil, err
 	}
 
+	contest.Phase = contestPhase(&contest, time.Now())
+
 	needPassword := false
 	// if check permission success, not need password
 	if err := CheckPermission(c, inviteData.AllowGroups, true); err != nil {
@@ -447,20 +546,40 @@ func JoinContest(c *gin.Context, inviteId string, password string) (err error) {
 	}
 
 	// if need password
-	if contestWrap.NeedPassword && password != contestWrap.Password {
-		log.For(ctx).Error("join contest password wrong", zap.Int("contestID", contestWrap.ID))
-		_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
-			SetMeta(kerror.ErrPasswordWrong)
-		return fmt.Errorf("join contest password wrong")
+	if contestWrap.NeedPassword {
+		if err := checkInvitePassword(c, password, contestWrap.Password); err != nil {
+			log.For(ctx).Error("join contest password wrong", zap.Int("contestID", contestWrap.ID))
+			return fmt.Errorf("join contest password wrong")
+		}
 	}
 
+	// check in transaction, so that concurrent joins don't exceed the cap
 	contest := contestWrap.Contest
+	tx := db.Begin()
+	err = lockContest(tx, &contest)
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"lock contest", contest.ID) != mysql.Success {
+		tx.Rollback()
+		return err
+	}
+	if err := checkContestFull(c, tx, &contest); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	user := model.User{
 		ID: auth.GetUserFromJWT(c).ID,
 	}
-	err = db.Model(&user).Association("Contests").Append(&contest).Error
+	err = tx.Model(&user).Association("Contests").Append(&contest).Error
 	if mysql.ErrorHandleAndLog(c, err, true,
 		"add user to contest", contest.ID) != mysql.Success {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit().Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"commit join contest", contest.ID) != mysql.Success {
 		return err
 	}
 
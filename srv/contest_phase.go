@@ -0,0 +1,63 @@
+package srv
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/si9ma/KillOJ-backend/auth"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/kerror"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/si9ma/KillOJ-common/mysql"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+// phase of contest at t, start time and end time are in running phase
+func contestPhase(contest *model.Contest, t time.Time) string {
+	switch {
+	case t.Before(contest.StartTime):
+		return model.ContestUpcoming
+	case t.After(contest.EndTime):
+		return model.ContestEnded
+	default:
+		return model.ContestRunning
+	}
+}
+
+// problems of upcoming contest are only visible to owner of contest
+func checkContestStarted(c *gin.Context, contest *model.Contest) error {
+	ctx := c.Request.Context()
+	myID := auth.GetUserFromJWT(c).ID
+
+	if contest.OwnerID == myID || contestPhase(contest, time.Now()) != model.ContestUpcoming {
+		return nil
+	}
+
+	log.For(ctx).Error("contest hasn't started", zap.Int("contestId", contest.ID))
+	_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
+		SetMeta(kerror.ErrContestNotStarted.WithArgs(contest.StartTime.Format(time.RFC3339)))
+	return kerror.EmptyError
+}
+
+// submit to problem of contest after the contest ended is for practice,
+// it's out of contest and isn't counted in scoreboard
+func isOutOfContest(c *gin.Context, problem *model.Problem) (bool, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	if problem.BelongType != model.BelongToContest {
+		return false, nil
+	}
+
+	// contest may be archived
+	contest := model.Contest{}
+	err := db.Unscoped().First(&contest, problem.BelongToID).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get contest of problem", problem.BelongToID) != mysql.Success {
+		return false, err
+	}
+
+	return contestPhase(&contest, time.Now()) == model.ContestEnded, nil
+}
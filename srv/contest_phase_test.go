@@ -0,0 +1,22 @@
+package srv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContestPhase(t *testing.T) {
+	start := time.Date(2019, 3, 1, 9, 0, 0, 0, time.Local)
+	contest := &model.Contest{
+		StartTime: start,
+		EndTime:   start.Add(2 * time.Hour),
+	}
+
+	assert.Equal(t, model.ContestUpcoming, contestPhase(contest, start.Add(-time.Second)))
+	assert.Equal(t, model.ContestRunning, contestPhase(contest, start))
+	assert.Equal(t, model.ContestRunning, contestPhase(contest, contest.EndTime))
+	assert.Equal(t, model.ContestEnded, contestPhase(contest, contest.EndTime.Add(time.Second)))
+}
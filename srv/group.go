@@ -43,26 +43,31 @@ const (
 	GroupInvitePrefix = "group_invite_"
 )
 
-func GetAllGroups(c *gin.Context, page, pageSize int, order string) ([]model.Group, error) {
+func GetAllGroups(c *gin.Context, spec *data.PageSpec) (*data.PageResult, error) {
 	var err error
 
 	ctx := c.Request.Context()
 	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
-	offset := (page - 1) * pageSize
 	user := model.User{
 		ID: auth.GetUserFromJWT(c).ID,
 	}
 
-	if order != "" {
-		err = db.Preload("Groups", func(db *gorm.DB) *gorm.DB {
-			return db.Order(order).Offset(offset).Limit(pageSize)
-		}).Preload("Groups.Owner").First(&user).Error
-	} else {
-		err = db.Preload("Groups", func(db *gorm.DB) *gorm.DB {
-			return db.Offset(offset).Limit(pageSize)
-		}).Preload("Groups.Owner").First(&user).Error
+	if err := CheckSort(c, spec.Sorts, groupSortFields); err != nil {
+		return nil, err
+	}
+
+	total := 0
+	err = db.Model(&model.Group{}).Joins("join user_in_group on user_in_group.group_id = `group`.id").
+		Where("user_in_group.user_id = ?", user.ID).Count(&total).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"count groups", nil) != mysql.Success {
+		return nil, err
 	}
 
+	err = db.Preload("Groups", func(db *gorm.DB) *gorm.DB {
+		return OrderBy(db, spec.Sorts, groupSortFields).Offset(spec.Offset).Limit(spec.Limit)
+	}).Preload("Groups.Owner").First(&user).Error
+
 	// error handle
 	if mysql.ErrorHandleAndLog(c, err, true,
 		"get groups", nil) != mysql.Success {
@@ -70,7 +75,7 @@ func GetAllGroups(c *gin.Context, page, pageSize int, order string) ([]model.Gro
 	}
 
 	log.For(ctx).Info("success get groups")
-	return user.Groups, nil
+	return NewPageResult(spec, total, user.Groups), nil
 }
 
 func GetGroup(c *gin.Context, id int) (*model.Group, error) {
@@ -196,31 +201,77 @@ func checkGroupOwner(c *gin.Context, group *model.Group) error {
 	return nil
 }
 
-//func DeleteGroup(c *gin.Context, id int) error {
-//	ctx := c.Request.Context()
-//	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
-//
-//	// check if group exist
-//	group, err := GetGroup(c, id)
-//	if err != nil {
-//		return err
-//	}
-//
-//	// check owner
-//	if err := checkGroupOwner(c, group); err != nil {
-//		return err
-//	}
-//	// todo should check have problem under this group
-//
-//	err = db.Delete(&group).Error
-//	if mysql.ErrorHandleAndLog(c, err, true,
-//		"delete group", id) != mysql.Success {
-//		return err
-//	}
-//	log.For(ctx).Info("delete group success", zap.Int("groupId", id))
-//
-//	return nil
-//}
+// get group which user can manage(owner or administrator)
+func getGroup4Manage(c *gin.Context, id int) (*model.Group, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	if isAdministrator(c) {
+		group := model.Group{}
+		err := db.First(&group, id).Error
+		if mysql.ErrorHandleAndLog(c, err, true, "get group", id) != mysql.Success {
+			return nil, err
+		}
+		return &group, nil
+	}
+
+	group, err := GetGroup(c, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkGroupOwner(c, group); err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+// archive group, problems and submits of group are kept
+func DeleteGroup(c *gin.Context, id int) error {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	// only owner and administrator can delete group
+	group, err := getGroup4Manage(c, id)
+	if err != nil {
+		return err
+	}
+
+	err = db.Delete(group).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"delete group", id) != mysql.Success {
+		return err
+	}
+	log.For(ctx).Info("delete group success", zap.Int("groupId", id))
+
+	return nil
+}
+
+// restore archived group, only for administrator
+func RestoreGroup(c *gin.Context, id int) error {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	group := model.Group{}
+	err := db.Unscoped().Where("deleted_at is not null").First(&group, id).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get archived group", id) != mysql.Success {
+		return err
+	}
+
+	// name may be used by another group after archived
+	if !groupCheckUnique(c, &model.Group{}, &group) {
+		return fmt.Errorf("check unique fail")
+	}
+
+	err = db.Unscoped().Model(&group).Update("deleted_at", nil).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"restore group", id) != mysql.Success {
+		return err
+	}
+	log.For(ctx).Info("restore group success", zap.Int("groupId", id))
+
+	return nil
+}
 
 func GetGroupInviteInfo(c *gin.Context, groupID int) (*data.GroupInviteData, error) {
 	ctx := c.Request.Context()
@@ -280,6 +331,12 @@ func Invite2Group(c *gin.Context, inviteData *data.GroupInviteData) (err error)
 	}
 	inviteData.ID = uuid.String()
 
+	// only hash of password is saved
+	inviteData.HasPassword = inviteData.Password != ""
+	if inviteData.Password, err = hashInvitePassword(c, inviteData.Password); err != nil {
+		return err
+	}
+
 	// save invite data to redis
 	res, err := kjson.MarshalString(inviteData)
 	if err != nil {
@@ -329,6 +386,7 @@ func GetGroupInviteData(c *gin.Context, inviteId string) (*data.GroupInviteData,
 		wrap.SetInternalServerError(c, err)
 		return nil, err
 	}
+	inviteData.HasPassword = inviteData.Password != "" // invite created before hashing don't have this field
 
 	return &inviteData, nil
 }
@@ -368,11 +426,11 @@ func JoinGroup(c *gin.Context, inviteId string, password string) (err error) {
 	}
 
 	// if need password
-	if groupWrap.NeedPassword && password != groupWrap.Password {
-		log.For(ctx).Error("join group password wrong", zap.Int("groupID", groupWrap.ID))
-		_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
-			SetMeta(kerror.ErrPasswordWrong)
-		return fmt.Errorf("join group password wrong")
+	if groupWrap.NeedPassword {
+		if err := checkInvitePassword(c, password, groupWrap.Password); err != nil {
+			log.For(ctx).Error("join group password wrong", zap.Int("groupID", groupWrap.ID))
+			return fmt.Errorf("join group password wrong")
+		}
 	}
 
 	group := groupWrap.Group
@@ -0,0 +1,219 @@
+package srv
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/si9ma/KillOJ-backend/auth"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/kerror"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/kredis"
+	"github.com/si9ma/KillOJ-common/log"
+	"go.uber.org/zap"
+	"gopkg.in/hlandau/passlib.v1"
+	"gopkg.in/hlandau/passlib.v1/abstract"
+)
+
+const (
+	// count of wrong invite password of user and ip
+	JoinFailUserPrefix = "killoj_join_fail_user_"
+	JoinFailIPPrefix   = "killoj_join_fail_ip_"
+
+	maxJoinFailOfUser = 5
+	maxJoinFailOfIP   = 20
+	joinFailWindow    = 15 * time.Minute // wrong attempts are forgotten after window
+	joinFailLockout   = 30 * time.Minute // locked after too many wrong attempts
+)
+
+type joinLimit struct {
+	key string
+	max int
+}
+
+// ip of client, forwarded headers are only used when peer is a trusted proxy,
+// because they can be spoofed by client.
+// X-Forwarded-For is walked from right to left, the first untrusted address is the client
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	if !isTrustedProxy(ip, trusted) {
+		return ip
+	}
+
+	forwarded := r.Header.Get("X-Forwarded-For")
+	if forwarded == "" {
+		if realIP := strings.TrimSpace(r.Header.Get("X-Real-Ip")); net.ParseIP(realIP) != nil {
+			return realIP
+		}
+		return ip
+	}
+
+	hops := strings.Split(forwarded, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !isTrustedProxy(hop, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+func isTrustedProxy(ip string, trusted []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range trusted {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// wrong attempts are counted for both user and ip,
+// so that brute force with many accounts is also limited
+func joinLimits(c *gin.Context) []joinLimit {
+	return []joinLimit{
+		{key: JoinFailUserPrefix + strconv.Itoa(auth.GetUserFromJWT(c).ID), max: maxJoinFailOfUser},
+		{key: JoinFailIPPrefix + clientIP(c.Request, gbl.TrustedProxies), max: maxJoinFailOfIP},
+	}
+}
+
+// hash password of invite, empty password means no password
+func hashInvitePassword(c *gin.Context, password string) (string, error) {
+	ctx := c.Request.Context()
+
+	if password == "" {
+		return "", nil
+	}
+
+	hash, err := passlib.Hash(password)
+	if err != nil {
+		log.For(ctx).Error("hash invite password fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return "", err
+	}
+
+	return hash, nil
+}
+
+// invite created before password is hashed keeps plaintext password until it expires,
+// so fallback to constant time comparison when stored value isn't a hash
+func verifyInvitePassword(password, stored string) bool {
+	err := passlib.VerifyNoUpgrade(password, stored)
+	if err == abstract.ErrUnsupportedScheme {
+		return subtle.ConstantTimeCompare([]byte(password), []byte(stored)) == 1
+	}
+	return err == nil
+}
+
+// minutes to wait, at least 1 minute
+func lockoutMinutes(ttl time.Duration) int {
+	minutes := int((ttl + time.Minute - 1) / time.Minute)
+	if minutes < 1 {
+		minutes = 1
+	}
+	return minutes
+}
+
+func checkJoinThrottle(c *gin.Context) error {
+	ctx := c.Request.Context()
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+
+	for _, limit := range joinLimits(c) {
+		count, err := redisCli.Get(limit.key).Int()
+		if err == redis.Nil {
+			continue
+		}
+		if kredis.ErrorHandleAndLog(c, err, true,
+			"get count of wrong invite password", limit.key, nil) != kredis.Success {
+			return err
+		}
+
+		if count >= limit.max {
+			ttl, err := redisCli.TTL(limit.key).Result()
+			if kredis.ErrorHandleAndLog(c, err, true,
+				"get lockout of join", limit.key, nil) != kredis.Success {
+				return err
+			}
+
+			log.For(ctx).Error("too many wrong invite password", zap.String("key", limit.key),
+				zap.Int("count", count))
+			_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
+				SetMeta(kerror.ErrTooManyAttempts.WithArgs(lockoutMinutes(ttl)))
+			return kerror.EmptyError
+		}
+	}
+
+	return nil
+}
+
+// count wrong attempt in best effort, fail to count don't fail the request
+func recordJoinFail(c *gin.Context) {
+	ctx := c.Request.Context()
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+
+	for _, limit := range joinLimits(c) {
+		count, err := redisCli.Incr(limit.key).Result()
+		if err != nil {
+			log.For(ctx).Error("count wrong invite password fail", zap.Error(err), zap.String("key", limit.key))
+			continue
+		}
+
+		expiration := joinFailWindow
+		if count >= int64(limit.max) {
+			expiration = joinFailLockout
+		} else if count > 1 {
+			continue
+		}
+		if err := redisCli.Expire(limit.key, expiration).Err(); err != nil {
+			log.For(ctx).Error("set expiration of wrong invite password fail", zap.Error(err),
+				zap.String("key", limit.key))
+		}
+	}
+}
+
+// only count of user is reset after success, other users may share the ip
+func resetJoinFail(c *gin.Context) {
+	ctx := c.Request.Context()
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+
+	key := JoinFailUserPrefix + strconv.Itoa(auth.GetUserFromJWT(c).ID)
+	if err := redisCli.Del(key).Err(); err != nil {
+		log.For(ctx).Error("reset count of wrong invite password fail", zap.Error(err), zap.String("key", key))
+	}
+}
+
+// check password of invite with throttling
+func checkInvitePassword(c *gin.Context, password, stored string) error {
+	ctx := c.Request.Context()
+
+	if err := checkJoinThrottle(c); err != nil {
+		return err
+	}
+
+	if !verifyInvitePassword(password, stored) {
+		recordJoinFail(c)
+		log.For(ctx).Error("invite password wrong")
+		_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrPasswordWrong)
+		return kerror.EmptyError
+	}
+
+	resetJoinFail(c)
+	return nil
+}
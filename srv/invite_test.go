@@ -0,0 +1,60 @@
+package srv
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/hlandau/passlib.v1"
+)
+
+func TestVerifyInvitePassword(t *testing.T) {
+	hash, err := passlib.Hash("secret")
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, "secret", hash)
+		assert.True(t, verifyInvitePassword("secret", hash))
+		assert.False(t, verifyInvitePassword("wrong", hash))
+	}
+
+	// plaintext password of legacy invite
+	assert.True(t, verifyInvitePassword("secret", "secret"))
+	assert.False(t, verifyInvitePassword("secre", "secret"))
+}
+
+func TestLockoutMinutes(t *testing.T) {
+	assert.Equal(t, 1, lockoutMinutes(-time.Second))
+	assert.Equal(t, 1, lockoutMinutes(30*time.Second))
+	assert.Equal(t, 30, lockoutMinutes(30*time.Minute))
+	assert.Equal(t, 30, lockoutMinutes(29*time.Minute+time.Second))
+}
+
+func TestClientIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	trusted := []*net.IPNet{proxies}
+
+	// forwarded headers of untrusted peer are ignored
+	r := &http.Request{RemoteAddr: "1.2.3.4:52100", Header: http.Header{}}
+	r.Header.Set("X-Forwarded-For", "5.6.7.8")
+	assert.Equal(t, "1.2.3.4", clientIP(r, trusted))
+	r.RemoteAddr = "10.0.0.1:52100"
+	assert.Equal(t, "10.0.0.1", clientIP(r, nil))
+
+	// the first untrusted hop from right
+	assert.Equal(t, "5.6.7.8", clientIP(r, trusted))
+	r.Header.Set("X-Forwarded-For", "9.9.9.9, 5.6.7.8, 10.0.0.2")
+	assert.Equal(t, "5.6.7.8", clientIP(r, trusted))
+
+	r.Header.Del("X-Forwarded-For")
+	r.Header.Set("X-Real-Ip", "5.6.7.8")
+	assert.Equal(t, "5.6.7.8", clientIP(r, trusted))
+
+	r.Header.Del("X-Real-Ip")
+	r.RemoteAddr = "[::1]:52100"
+	assert.Equal(t, "::1", clientIP(r, trusted))
+
+	// without port
+	r.RemoteAddr = "10.0.0.1"
+	assert.Equal(t, "10.0.0.1", clientIP(r, trusted))
+}
@@ -0,0 +1,124 @@
+package srv
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/kerror"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/si9ma/KillOJ-common/mysql"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+// default tolerance of float checker
+const defaultFloatTolerance = 1e-6
+
+// check checker and interactor config of problem, and fill default value
+func checkJudgeConfig(c *gin.Context, problem *model.Problem) error {
+	ctx := c.Request.Context()
+
+	switch problem.CheckerType {
+	case model.FloatChecker:
+		if problem.FloatTolerance == 0 {
+			problem.FloatTolerance = defaultFloatTolerance
+		}
+	case model.SpecialChecker:
+		if problem.CheckerSource == "" {
+			err := fmt.Errorf("checker source is empty")
+			log.For(ctx).Error("special checker without source", zap.String("problem", problem.Name))
+			_ = c.Error(err).SetType(gin.ErrorTypePublic).
+				SetMeta(kerror.ErrMustProvideWhenAnotherExist.WithArgs("checker_type", "checker_source"))
+			return err
+		}
+	}
+
+	// source is useless for other checkers
+	if problem.CheckerType != model.SpecialChecker {
+		problem.CheckerSource = ""
+		problem.CheckerLanguage = 0
+	}
+
+	if problem.Type == model.InteractiveProblem {
+		if problem.InteractorSource == "" {
+			err := fmt.Errorf("interactor source is empty")
+			log.For(ctx).Error("interactive problem without interactor", zap.String("problem", problem.Name))
+			_ = c.Error(err).SetType(gin.ErrorTypePublic).
+				SetMeta(kerror.ErrMustProvideWhenAnotherExist.WithArgs("type", "interactor_source"))
+			return err
+		}
+
+		// the verdict of interactive problem is given by interactor
+		if problem.CheckerType != model.ExactChecker {
+			err := fmt.Errorf("interactive problem can't have checker")
+			log.For(ctx).Error("interactive problem with checker", zap.String("problem", problem.Name))
+			fields := map[string]interface{}{
+				"checker_type": "interactive problem is judged by interactor, checker is not allowed",
+			}
+			_ = c.Error(err).SetType(gin.ErrorTypePublic).
+				SetMeta(kerror.ErrArgValidateFail.With(fields))
+			return err
+		}
+	} else {
+		problem.InteractorSource = ""
+		problem.InteractorLanguage = 0
+	}
+
+	return nil
+}
+
+// gorm don't update zero value when update with struct,
+// so update judge config separately, eg: change checker back to exact checker
+func updateJudgeConfig(c *gin.Context, db *gorm.DB, problem *model.Problem) error {
+	err := db.Model(&model.Problem{ID: problem.ID}).Updates(map[string]interface{}{
+		"checker_type":        problem.CheckerType,
+		"float_tolerance":     problem.FloatTolerance,
+		"checker_source":      problem.CheckerSource,
+		"checker_language":    problem.CheckerLanguage,
+		"type":                problem.Type,
+		"interactor_source":   problem.InteractorSource,
+		"interactor_language": problem.InteractorLanguage,
+	}).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"update judge config of problem", problem.ID) != mysql.Success {
+		return err
+	}
+
+	return nil
+}
+
+// checker and interactor config for judger, interactor is nil for traditional problem,
+// query from db because source of checker and interactor isn't visible to user
+func getJudgeConfig(c *gin.Context, problemID int) (*data.CheckerConfig, *data.InteractorConfig, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	problem := model.Problem{}
+	err := db.Select("id, checker_type, float_tolerance, checker_source, checker_language, "+
+		"type, interactor_source, interactor_language").First(&problem, problemID).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get judge config of problem", problemID) != mysql.Success {
+		return nil, nil, err
+	}
+
+	checker := &data.CheckerConfig{
+		Type:           problem.CheckerType,
+		FloatTolerance: problem.FloatTolerance,
+		Source:         problem.CheckerSource,
+		Language:       problem.CheckerLanguage,
+	}
+
+	var interactor *data.InteractorConfig
+	if problem.Type == model.InteractiveProblem {
+		interactor = &data.InteractorConfig{
+			Source:   problem.InteractorSource,
+			Language: problem.InteractorLanguage,
+		}
+	}
+
+	return checker, interactor, nil
+}
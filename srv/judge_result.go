@@ -0,0 +1,253 @@
+package srv
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/constants"
+	"github.com/si9ma/KillOJ-common/judge"
+	"github.com/si9ma/KillOJ-common/kjson"
+	"github.com/si9ma/KillOJ-common/kredis"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	JudgingSubmitsKey = "killoj_judging_submits" // hash of submits sent to judger, field is submit id
+
+	judgeCollectInterval = 2 * time.Second
+	judgeCollectBatch    = 500
+
+	// submit still incomplete after timeout is treated as lost, and it's dropped
+	judgeTrackTimeout = 24 * time.Hour
+)
+
+// collect result of complete submits periodically
+func StartJudgeCollector() {
+	go func() {
+		for range time.Tick(judgeCollectInterval) {
+			if err := collectJudgeResults(context.Background()); err != nil {
+				log.Bg().Error("collect judge result fail", zap.Error(err))
+			}
+		}
+	}()
+}
+
+// track submits before sending them to judger,
+// submit which is already tracked isn't marked as rejudge,
+// because it hasn't been collected, and rank of its periods should be updated
+func trackJudging(c *gin.Context, items []data.JudgingSubmit) error {
+	ctx := c.Request.Context()
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+
+	pipe := redisCli.Pipeline()
+	for _, item := range items {
+		value, err := kjson.MarshalString(item)
+		if err != nil {
+			log.For(ctx).Error("marshal json fail", zap.Error(err))
+			wrap.SetInternalServerError(c, err)
+			return err
+		}
+
+		field := strconv.Itoa(item.SubmitID)
+		if item.Rejudge {
+			pipe.HSetNX(JudgingSubmitsKey, field, value)
+		} else {
+			pipe.HSet(JudgingSubmitsKey, field, value)
+		}
+	}
+	_, err := pipe.Exec()
+	if kredis.ErrorHandleAndLog(c, err, true,
+		"track judging submits", JudgingSubmitsKey, nil) != kredis.Success {
+		return err
+	}
+
+	return nil
+}
+
+// collect tracked submits which are complete,
+// and drop submits which are deleted or lost
+func collectJudgeResults(ctx context.Context) error {
+	var submits []model.Submit
+
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+
+	// rank is updated when collect, so that only one instance can collect at the same time
+	if ok, err := lockRank(redisCli); err != nil || !ok {
+		return err
+	}
+	defer unlockRank(redisCli)
+
+	// build rank when rank never built
+	if built, err := redisCli.Exists(RankBuiltKey).Result(); err != nil {
+		return err
+	} else if built == 0 {
+		if err := rebuildRank(ctx); err != nil {
+			return err
+		}
+	}
+
+	values, err := redisCli.HGetAll(JudgingSubmitsKey).Result()
+	if err != nil || len(values) == 0 {
+		return err
+	}
+
+	judging := make(map[int]data.JudgingSubmit)
+	var ids []int
+	for field, value := range values {
+		item := data.JudgingSubmit{}
+		if err := kjson.UnmarshalString(value, &item); err != nil {
+			log.Bg().Error("unmarshal judging submit fail, drop it", zap.Error(err), zap.String("submitID", field))
+			redisCli.HDel(JudgingSubmitsKey, field)
+			continue
+		}
+
+		judging[item.SubmitID] = item
+		ids = append(ids, item.SubmitID)
+		if len(ids) >= judgeCollectBatch {
+			break
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	err = db.Select("id, user_id, problem_id, result, is_complete, created_at").
+		Where("id in (?)", ids).Find(&submits).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range submits {
+		submit := &submits[i]
+		item := judging[submit.ID]
+		delete(judging, submit.ID)
+
+		if !submit.IsComplete {
+			if time.Since(item.SentAt) > judgeTrackTimeout {
+				log.Bg().Error("submit is still incomplete after timeout, drop it", zap.Int("submitID", submit.ID))
+				redisCli.HDel(JudgingSubmitsKey, strconv.Itoa(submit.ID))
+			}
+			continue
+		}
+
+		if err := collectSubmit(ctx, redisCli, submit, &item); err != nil {
+			return err
+		}
+	}
+
+	// submits which are deleted
+	for id := range judging {
+		log.Bg().Error("judging submit not exist, drop it", zap.Int("submitID", id))
+		redisCli.HDel(JudgingSubmitsKey, strconv.Itoa(id))
+	}
+
+	return nil
+}
+
+// the submit is claimed before collecting, so that it's collected only once,
+// it's tracked again to retry later when fail
+func collectSubmit(ctx context.Context, redisCli *redis.ClusterClient,
+	submit *model.Submit, item *data.JudgingSubmit) error {
+	field := strconv.Itoa(submit.ID)
+	claimed, err := redisCli.HDel(JudgingSubmitsKey, field).Result()
+	if err != nil || claimed == 0 {
+		return err
+	}
+
+	if err = onJudgeComplete(ctx, redisCli, submit, item); err != nil {
+		if value, err := kjson.MarshalString(item); err == nil {
+			redisCli.HSetNX(JudgingSubmitsKey, field, value)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// handle result of submit once when judge complete, and update rank with it
+func onJudgeComplete(ctx context.Context, redisCli *redis.ClusterClient,
+	submit *model.Submit, item *data.JudgingSubmit) error {
+	result, err := getJudgeResult(redisCli, submit.ID)
+	if err != nil {
+		return err
+	}
+
+	// keep the detail of final result, the result in redis will be removed after timeout
+	if result != nil {
+		if err := saveSubmitResult(ctx, submit.ID, result); err != nil {
+			return err
+		}
+		if err := savePassedCases(ctx, submit, result); err != nil {
+			return err
+		}
+	}
+
+	// stat and rank are calculated from complete submits, it's safe to collect again
+	if err := refreshProblemStat(ctx, submit.ProblemID); err != nil {
+		return err
+	}
+	return updateRank4Submit(ctx, redisCli, submit, item.Rejudge)
+}
+
+// final result reported by judger, nil when it's not exist
+func getJudgeResult(redisCli *redis.ClusterClient, submitID int) (*judge.OuterResult, error) {
+	k := constants.SubmitStatusKeyPrefix + strconv.Itoa(submitID)
+	res, err := redisCli.Get(k).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	result := judge.OuterResult{}
+	if err := kjson.UnmarshalString(res, &result); err != nil {
+		log.Bg().Error("unmarshal status of submit fail", zap.Error(err), zap.Int("submitID", submitID))
+		return nil, nil
+	}
+	if !result.IsComplete {
+		return nil, nil
+	}
+
+	return &result, nil
+}
+
+// save passed test cases for score of OI style contest,
+// count of test cases is also saved in case the judger doesn't report passed cases
+func savePassedCases(ctx context.Context, submit *model.Submit, result *judge.OuterResult) error {
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	submit.PassedCases = model.IntSlice(result.PassedCases)
+	submit.PassedNum = result.SuccessTestCase
+	submit.CaseNum = result.TestCaseNum
+	return db.Model(submit).Updates(map[string]interface{}{
+		"passed_cases": submit.PassedCases,
+		"passed_num":   submit.PassedNum,
+		"case_num":     submit.CaseNum,
+	}).Error
+}
+
+// save judge result detail of submit
+func saveSubmitResult(ctx context.Context, submitID int, result *judge.OuterResult) error {
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	detail, err := kjson.MarshalString(result)
+	if err != nil {
+		return err
+	}
+
+	submitResult := model.SubmitResult{
+		SubmitID: submitID,
+		Detail:   model.JSON(detail),
+	}
+	return db.Save(&submitResult).Error
+}
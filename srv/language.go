@@ -0,0 +1,82 @@
+package srv
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/kerror"
+	"github.com/si9ma/KillOJ-backend/language"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/si9ma/KillOJ-common/mysql"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+func GetAllLanguages(c *gin.Context) []language.Language {
+	return language.All()
+}
+
+// get language from registry, language may be removed from registry after submit
+func getLanguage(c *gin.Context, id int) (*language.Language, error) {
+	ctx := c.Request.Context()
+
+	lang, ok := language.Get(id)
+	if !ok {
+		err := fmt.Errorf("language %d not exist", id)
+		log.For(ctx).Error("language not exist", zap.Int("language", id))
+		wrap.SetInternalServerError(c, err)
+		return nil, err
+	}
+
+	return &lang, nil
+}
+
+// languages can be used to submit for problem,
+// allowed languages of contest override allowed languages of problem,
+// empty allowed languages means all languages in registry
+func getAvailableLanguages(c *gin.Context, problem *model.Problem) ([]int, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	allowed := problem.AllowedLanguages
+	if problem.BelongType == model.BelongToContest {
+		contest := model.Contest{}
+		err := db.Unscoped().Select("id, allowed_languages").First(&contest, problem.BelongToID).Error
+		if mysql.ErrorHandleAndLog(c, err, true,
+			"get allowed languages of contest", problem.BelongToID) != mysql.Success {
+			return nil, err
+		}
+		if len(contest.AllowedLanguages) > 0 {
+			allowed = contest.AllowedLanguages
+		}
+	}
+
+	// language may be removed from registry
+	available := []int{}
+	for _, lang := range language.All() {
+		if len(allowed) == 0 || allowed.Contains(lang.ID) {
+			available = append(available, lang.ID)
+		}
+	}
+
+	return available, nil
+}
+
+func checkLanguageAllowed(c *gin.Context, problem *model.Problem, lang int) error {
+	ctx := c.Request.Context()
+
+	for _, id := range problem.AvailableLanguages {
+		if id == lang {
+			return nil
+		}
+	}
+
+	log.For(ctx).Error("language not allowed for problem",
+		zap.Int("problemID", problem.ID), zap.Int("language", lang))
+	_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
+		SetMeta(kerror.ErrLanguageNotAllowed.WithArgs(lang, problem.AvailableLanguages))
+	return kerror.EmptyError
+}
@@ -0,0 +1,122 @@
+package srv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/si9ma/KillOJ-backend/kerror"
+	"github.com/si9ma/KillOJ-backend/language"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"go.uber.org/zap"
+)
+
+// parse limits of specific languages from limit json of problem,
+// limit json of problem created before limits of languages are supported is an object,
+// it's returned as legacy limit, which is the limit of all languages
+func parseLimits(problem *model.Problem) ([]model.Limit, *model.Limit, error) {
+	var limits []model.Limit
+
+	if problem.Limit.IsNull() {
+		return limits, nil, nil
+	}
+
+	if raw := bytes.TrimSpace(problem.Limit); len(raw) > 0 && raw[0] == '{' {
+		legacy := model.Limit{}
+		if err := json.Unmarshal(raw, &legacy); err != nil {
+			return nil, nil, err
+		}
+		return nil, &legacy, nil
+	}
+
+	if err := json.Unmarshal(problem.Limit, &limits); err != nil {
+		return nil, nil, err
+	}
+
+	return limits, nil, nil
+}
+
+// check limit table of problem, every language can only have one limit,
+// and the limit json is normalized after check
+func checkLimits(c *gin.Context, problem *model.Problem) error {
+	ctx := c.Request.Context()
+
+	fail := func(err error, reason string) error {
+		log.For(ctx).Error("invalid limit of problem", zap.String("problem", problem.Name), zap.Error(err))
+		fields := map[string]interface{}{
+			"limit": reason,
+		}
+		_ = c.Error(err).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrArgValidateFail.With(fields))
+		return err
+	}
+
+	limits, legacy, err := parseLimits(problem)
+	if err != nil {
+		return fail(err, "limit should be an array of language, time_limit and memory_limit")
+	}
+
+	// legacy limit is kept, it's still valid for all languages
+	if legacy != nil {
+		if legacy.TimeLimit <= 0 || legacy.MemoryLimit <= 0 {
+			return fail(fmt.Errorf("invalid legacy limit"),
+				"time_limit and memory_limit should be greater than 0")
+		}
+		return nil
+	}
+
+	exist := make(map[int]bool)
+	for _, limit := range limits {
+		if !language.Exist(limit.Language) {
+			return fail(fmt.Errorf("language %d not exist", limit.Language),
+				fmt.Sprintf("language %d not exist", limit.Language))
+		}
+		if exist[limit.Language] {
+			return fail(fmt.Errorf("duplicate limit of language %d", limit.Language),
+				fmt.Sprintf("language %d has more than one limit", limit.Language))
+		}
+		if limit.TimeLimit <= 0 || limit.MemoryLimit <= 0 {
+			return fail(fmt.Errorf("invalid limit of language %d", limit.Language),
+				fmt.Sprintf("time_limit and memory_limit of language %d should be greater than 0", limit.Language))
+		}
+		exist[limit.Language] = true
+	}
+
+	if limits == nil {
+		limits = []model.Limit{}
+	}
+	res, err := json.Marshal(limits)
+	if err != nil {
+		log.For(ctx).Error("marshal json fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return err
+	}
+	problem.Limit = res
+
+	return nil
+}
+
+// limit of problem for language, use limit of language when it's set,
+// otherwise scale default limit of problem by factors of language,
+// legacy limit is used as is for all languages, same as before
+func resolveLimit(problem *model.Problem, lang *language.Language) (int, int, error) {
+	limits, legacy, err := parseLimits(problem)
+	if err != nil {
+		return 0, 0, err
+	}
+	if legacy != nil && legacy.TimeLimit > 0 && legacy.MemoryLimit > 0 {
+		return legacy.TimeLimit, legacy.MemoryLimit, nil
+	}
+
+	for _, limit := range limits {
+		if limit.Language == lang.ID {
+			return limit.TimeLimit, limit.MemoryLimit, nil
+		}
+	}
+
+	timeLimit, memoryLimit := lang.Limit(problem.TimeLimit, problem.MemoryLimit)
+	return timeLimit, memoryLimit, nil
+}
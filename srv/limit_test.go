@@ -0,0 +1,47 @@
+package srv
+
+import (
+	"testing"
+
+	"github.com/si9ma/KillOJ-backend/language"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveLimit(t *testing.T) {
+	problem := &model.Problem{
+		TimeLimit:   1000,
+		MemoryLimit: 65536,
+		Limit:       model.JSON(`[{"language":3,"time_limit":1500,"memory_limit":131072}]`),
+	}
+	java := &language.Language{ID: 2, TimeFactor: 2, MemoryFactor: 2}
+	golang := &language.Language{ID: 3, TimeFactor: 1, MemoryFactor: 1}
+
+	timeLimit, memoryLimit, err := resolveLimit(problem, java)
+	assert.NoError(t, err)
+	assert.Equal(t, 2000, timeLimit)
+	assert.Equal(t, 131072, memoryLimit)
+
+	timeLimit, memoryLimit, err = resolveLimit(problem, golang)
+	assert.NoError(t, err)
+	assert.Equal(t, 1500, timeLimit)
+	assert.Equal(t, 131072, memoryLimit)
+
+	// legacy limit is the limit of all languages
+	problem.Limit = model.JSON(`{"time_limit":3000,"memory_limit":262144}`)
+	timeLimit, memoryLimit, err = resolveLimit(problem, java)
+	assert.NoError(t, err)
+	assert.Equal(t, 3000, timeLimit)
+	assert.Equal(t, 262144, memoryLimit)
+
+	// incomplete legacy limit falls back to default limit
+	problem.Limit = model.JSON(`{"time_limit":1}`)
+	timeLimit, memoryLimit, err = resolveLimit(problem, golang)
+	assert.NoError(t, err)
+	assert.Equal(t, 1000, timeLimit)
+	assert.Equal(t, 65536, memoryLimit)
+
+	problem.Limit = model.JSON(`"1000"`)
+	_, _, err = resolveLimit(problem, golang)
+	assert.Error(t, err)
+}
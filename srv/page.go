@@ -0,0 +1,225 @@
+package srv
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/kerror"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/mysql"
+	"github.com/si9ma/KillOJ-common/tip"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+const maxSortKeys = 3
+
+// whitelist of sortable fields, field name exposed to client -> column,
+// field "id" is used to break tie so that pages are stable
+type SortFields map[string]string
+
+var (
+	problemSortFields = SortFields{
+		"id":           "problem.id",
+		"name":         "problem.name",
+		"difficulty":   "problem.difficulty",
+		"time_limit":   "problem.time_limit",
+		"memory_limit": "problem.memory_limit",
+		"created_at":   "problem.created_at",
+	}
+	submitSortFields = SortFields{
+		"id":           "submit.id",
+		"created_at":   "submit.created_at",
+		"result":       "submit.result",
+		"language":     "submit.language",
+		"run_time":     "submit.run_time",
+		"memory_usage": "submit.memory_usage",
+	}
+	contestSortFields = SortFields{
+		"id":         "contest.id",
+		"name":       "contest.name",
+		"start_time": "contest.start_time",
+		"end_time":   "contest.end_time",
+		"created_at": "contest.created_at",
+	}
+	groupSortFields = SortFields{
+		"id":         "`group`.id",
+		"name":       "`group`.name",
+		"created_at": "`group`.created_at",
+	}
+	catalogSortFields = SortFields{
+		"id":   "catalog.id",
+		"name": "catalog.name",
+	}
+	UserSortFields = SortFields{
+		"id":           "user.id",
+		"name":         "user.name",
+		"organization": "user.organization",
+		"created_at":   "user.created_at",
+	}
+)
+
+func (fields SortFields) names() string {
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+// build page spec from cursor or page, cursor is preferred,
+// order is a comma separated list of "field", "-field" or "field asc|desc"
+func NewPageSpec(c *gin.Context, page, pageSize int, cursor, order string) (*data.PageSpec, error) {
+	ctx := c.Request.Context()
+	spec := data.PageSpec{Limit: pageSize}
+
+	if cursor != "" {
+		offset, err := decodeCursor(cursor)
+		if err != nil {
+			log.For(ctx).Error("decode cursor fail", zap.Error(err), zap.String("cursor", cursor))
+			fields := map[string]string{
+				"cursor": fmt.Sprintf(tip.ValidateInvalidTip.String(), "cursor"),
+			}
+			_ = c.Error(err).SetType(gin.ErrorTypePublic).SetMeta(kerror.ErrArgValidateFail.With(fields))
+			return nil, err
+		}
+		spec.Offset = offset
+	} else if page > 1 {
+		spec.Offset = (page - 1) * pageSize
+	}
+
+	sorts, err := parseSort(order)
+	if err != nil {
+		log.For(ctx).Error("parse order fail", zap.Error(err), zap.String("order", order))
+		fields := map[string]string{
+			"order": fmt.Sprintf(tip.ValidateInvalidTip.String(), "order"),
+		}
+		_ = c.Error(err).SetType(gin.ErrorTypePublic).SetMeta(kerror.ErrArgValidateFail.With(fields))
+		return nil, err
+	}
+	spec.Sorts = sorts
+
+	return &spec, nil
+}
+
+func parseSort(order string) ([]data.SortSpec, error) {
+	var sorts []data.SortSpec
+	for _, item := range strings.Split(order, ",") {
+		words := strings.Fields(item)
+		if len(words) == 0 {
+			continue
+		}
+
+		spec := data.SortSpec{Field: words[0]}
+		switch {
+		case len(words) == 1 && strings.HasPrefix(spec.Field, "-"):
+			spec.Field, spec.Desc = spec.Field[1:], true
+		case len(words) == 1:
+		case len(words) == 2 && strings.EqualFold(words[1], "asc"):
+		case len(words) == 2 && strings.EqualFold(words[1], "desc"):
+			spec.Desc = true
+		default:
+			return nil, fmt.Errorf("invalid sort key %q", item)
+		}
+		if spec.Field == "" {
+			return nil, fmt.Errorf("invalid sort key %q", item)
+		}
+		sorts = append(sorts, spec)
+	}
+
+	if len(sorts) > maxSortKeys {
+		return nil, fmt.Errorf("too many sort keys")
+	}
+	return sorts, nil
+}
+
+// cursor is the base64 encoded offset of next page
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.Atoi(string(b))
+	if err != nil {
+		return 0, err
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset %d", offset)
+	}
+	return offset, nil
+}
+
+// check if all sort fields are in whitelist
+func CheckSort(c *gin.Context, sorts []data.SortSpec, fields SortFields) error {
+	ctx := c.Request.Context()
+
+	for _, spec := range sorts {
+		if _, ok := fields[spec.Field]; !ok {
+			err := fmt.Errorf("field %s isn't sortable", spec.Field)
+			log.For(ctx).Error("check sort fail", zap.Error(err))
+			errFields := map[string]string{
+				"order": fmt.Sprintf(tip.OneOfTip.String(), "order", fields.names()),
+			}
+			_ = c.Error(err).SetType(gin.ErrorTypePublic).SetMeta(kerror.ErrArgValidateFail.With(errFields))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// order by checked sort keys, then by id
+func OrderBy(db *gorm.DB, sorts []data.SortSpec, fields SortFields) *gorm.DB {
+	byID := false
+	for _, spec := range sorts {
+		column := fields[spec.Field]
+		if spec.Desc {
+			column += " desc"
+		}
+		db = db.Order(column)
+		byID = byID || spec.Field == "id"
+	}
+
+	if !byID {
+		db = db.Order(fields["id"])
+	}
+	return db
+}
+
+// count rows of query, query shouldn't be limited
+func CountRows(c *gin.Context, queryDB *gorm.DB, desc string) (int, error) {
+	var total int
+
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	err := db.Raw("select count(*) from ? as t", queryDB.SubQuery()).Row().Scan(&total)
+	if mysql.ErrorHandleAndLog(c, err, true, desc, nil) != mysql.Success {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+func NewPageResult(spec *data.PageSpec, total int, items interface{}) *data.PageResult {
+	result := data.PageResult{
+		Total: total,
+		Items: items,
+	}
+	if next := spec.Offset + spec.Limit; next < total {
+		result.NextCursor = encodeCursor(next)
+	}
+	return &result
+}
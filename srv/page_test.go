@@ -0,0 +1,62 @@
+package srv
+
+import (
+	"testing"
+
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSort(t *testing.T) {
+	sorts, err := parseSort("difficulty desc, -created_at,name ASC")
+	assert.NoError(t, err)
+	assert.Equal(t, []data.SortSpec{
+		{Field: "difficulty", Desc: true},
+		{Field: "created_at", Desc: true},
+		{Field: "name"},
+	}, sorts)
+
+	sorts, err = parseSort("")
+	assert.NoError(t, err)
+	assert.Empty(t, sorts)
+
+	for _, order := range []string{
+		"id; drop table user",
+		"id desc nulls",
+		"id up",
+		"-",
+		"a,b,c,d",
+	} {
+		_, err := parseSort(order)
+		assert.Error(t, err, order)
+	}
+}
+
+func TestSortFieldNames(t *testing.T) {
+	fields := SortFields{"id": "problem.id", "name": "problem.name"}
+	assert.Equal(t, "id name", fields.names())
+}
+
+func TestCursor(t *testing.T) {
+	offset, err := decodeCursor(encodeCursor(40))
+	assert.NoError(t, err)
+	assert.Equal(t, 40, offset)
+
+	_, err = decodeCursor("not a cursor")
+	assert.Error(t, err)
+	_, err = decodeCursor(encodeCursor(-1))
+	assert.Error(t, err)
+}
+
+func TestNewPageResult(t *testing.T) {
+	spec := &data.PageSpec{Offset: 20, Limit: 10}
+
+	result := NewPageResult(spec, 35, nil)
+	assert.Equal(t, 35, result.Total)
+	offset, err := decodeCursor(result.NextCursor)
+	assert.NoError(t, err)
+	assert.Equal(t, 30, offset)
+
+	result = NewPageResult(spec, 30, nil)
+	assert.Empty(t, result.NextCursor)
+}
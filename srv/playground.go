@@ -0,0 +1,332 @@
+package srv
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/RichardKnop/machinery/v1/tasks"
+	"github.com/gin-gonic/gin"
+	"github.com/guregu/null"
+	"github.com/opentracing/opentracing-go"
+	uuid "github.com/satori/go.uuid"
+	"github.com/si9ma/KillOJ-backend/auth"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/kerror"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/judge"
+	"github.com/si9ma/KillOJ-common/kjson"
+	"github.com/si9ma/KillOJ-common/kredis"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/si9ma/KillOJ-common/mysql"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	// judger save result of run to RunResultKeyPrefix + run id
+	RunResultKeyPrefix = "killoj_run_result_"
+	userRunKeyPrefix   = "killoj_user_run_"
+	runOwnerKeyPrefix  = "killoj_run_owner_" // owner of run, result of run is overwritten by judger
+	runResultTimeout   = 10 * time.Minute
+
+	// limit of playground run
+	runTimeLimit   = 5000   // ms
+	runMemoryLimit = 262144 // KB
+)
+
+func GetAllPlaygrounds(c *gin.Context) ([]model.Playground, error) {
+	var playgrounds []model.Playground
+
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	myID := auth.GetUserFromJWT(c).ID
+
+	// don't query source code
+	err := db.Select("id, user_id, created_at, updated_at, code_name, language").
+		Where("user_id = ?", myID).Order("updated_at desc").Find(&playgrounds).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get playgrounds", nil) != mysql.Success {
+		return nil, err
+	}
+
+	log.For(ctx).Info("success get playgrounds")
+	return playgrounds, nil
+}
+
+// playground is only visible to its owner
+func GetPlayground(c *gin.Context, id int) (*model.Playground, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	myID := auth.GetUserFromJWT(c).ID
+
+	playground := model.Playground{}
+	err := db.Where("user_id = ?", myID).First(&playground, id).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get playground", id) != mysql.Success {
+		return nil, err
+	}
+
+	return &playground, nil
+}
+
+func AddPlayground(c *gin.Context, newPlayground *model.Playground) error {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	newPlayground.ID = 0
+	newPlayground.UserID = auth.GetUserFromJWT(c).ID
+	err := db.Create(newPlayground).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"add playground", newPlayground.CodeName) != mysql.Success {
+		return err
+	}
+
+	log.For(ctx).Info("add playground success", zap.Int("playgroundId", newPlayground.ID))
+	return nil
+}
+
+// update playground, the old source code is saved as history
+func UpdatePlayground(c *gin.Context, newPlayground *model.Playground) error {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	oldPlayground, err := GetPlayground(c, newPlayground.ID)
+	if err != nil {
+		return err
+	}
+
+	tx := db.Begin()
+	if oldPlayground.SourceCode != newPlayground.SourceCode || oldPlayground.Language != newPlayground.Language {
+		history := model.PlaygroundHistory{
+			PlaygroundID: oldPlayground.ID,
+			SourceCode:   null.StringFrom(oldPlayground.SourceCode),
+			Language:     oldPlayground.Language,
+		}
+		err = tx.Create(&history).Error
+		if mysql.ErrorHandleAndLog(c, err, true,
+			"save playground history", oldPlayground.ID) != mysql.Success {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	newPlayground.UserID = oldPlayground.UserID
+	newPlayground.CreatedAt = oldPlayground.CreatedAt
+	err = tx.Save(newPlayground).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"update playground", newPlayground.ID) != mysql.Success {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit().Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"commit update of playground", newPlayground.ID) != mysql.Success {
+		return err
+	}
+
+	log.For(ctx).Info("update playground success", zap.Int("playgroundId", newPlayground.ID))
+	return nil
+}
+
+func DeletePlayground(c *gin.Context, id int) error {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	playground, err := GetPlayground(c, id)
+	if err != nil {
+		return err
+	}
+
+	tx := db.Begin()
+	err = tx.Where("playground_id = ?", id).Delete(&model.PlaygroundHistory{}).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"delete histories of playground", id) != mysql.Success {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Delete(playground).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"delete playground", id) != mysql.Success {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit().Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"commit delete of playground", id) != mysql.Success {
+		return err
+	}
+
+	log.For(ctx).Info("delete playground success", zap.Int("playgroundId", id))
+	return nil
+}
+
+func GetPlaygroundHistories(c *gin.Context, id int) ([]model.PlaygroundHistory, error) {
+	var histories []model.PlaygroundHistory
+
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	// check owner
+	if _, err := GetPlayground(c, id); err != nil {
+		return nil, err
+	}
+
+	err := db.Where("playground_id = ?", id).Order("id desc").Find(&histories).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get histories of playground", id) != mysql.Success {
+		return nil, err
+	}
+
+	return histories, nil
+}
+
+// run code with custom input by judger,
+// it neither creates submit nor affects statistics
+func Run(c *gin.Context, arg *data.RunArg) (*data.RunInfo, error) {
+	bgCtx := c.Request.Context()
+	span, ctx := opentracing.StartSpanFromContext(bgCtx, "sendRunTask")
+	defer span.Finish()
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+	myID := auth.GetUserFromJWT(c).ID
+
+	// only one running run for every user
+	userKey := userRunKeyPrefix + strconv.Itoa(myID)
+	lastID, err := redisCli.Get(userKey).Result()
+	switch kredis.ErrorHandleAndLog(c, err, false, "get last run of user", userKey, nil) {
+	case kredis.Success:
+		if res, err := GetRunResult(c, lastID); err == nil && !res.IsComplete {
+			log.For(ctx).Error("user already have running run", zap.String("runID", lastID))
+			_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).SetMeta(kerror.ErrHaveRunningTask)
+			return nil, kerror.EmptyError
+		}
+		wrap.DiscardGinError(c) // last run may be expired
+	case kredis.DB_ERROR:
+		return nil, err
+	}
+
+	lang, err := getLanguage(c, arg.Language)
+	if err != nil {
+		return nil, err
+	}
+	languageConfig, err := kjson.MarshalString(lang)
+	if err != nil {
+		log.For(ctx).Error("marshal json fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return nil, err
+	}
+	timeLimit, memoryLimit := lang.Limit(runTimeLimit, runMemoryLimit)
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		log.For(ctx).Error("generate uuid fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return nil, err
+	}
+	runID := id.String()
+
+	// mark as judging
+	res, err := kjson.MarshalString(judge.OuterResult{ID: runID, Status: judge.JudgingStatus})
+	if err != nil {
+		log.For(ctx).Error("marshal json fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return nil, err
+	}
+	k := RunResultKeyPrefix + runID
+	err = redisCli.Set(k, res, runResultTimeout).Err()
+	if kredis.ErrorHandleAndLog(c, err, true, "init run result", k, nil) != kredis.Success {
+		return nil, err
+	}
+	err = redisCli.Set(userKey, runID, runResultTimeout).Err()
+	if kredis.ErrorHandleAndLog(c, err, true, "save last run of user", userKey, nil) != kredis.Success {
+		return nil, err
+	}
+	ownerKey := runOwnerKeyPrefix + runID
+	err = redisCli.Set(ownerKey, myID, runResultTimeout).Err()
+	if kredis.ErrorHandleAndLog(c, err, true, "save owner of run", ownerKey, nil) != kredis.Success {
+		return nil, err
+	}
+
+	runTask := tasks.Signature{
+		Name: "run",
+		Args: []tasks.Arg{
+			{
+				Name:  "runId",
+				Type:  "string",
+				Value: runID,
+			},
+			{
+				Name:  "sourceCode",
+				Type:  "string",
+				Value: arg.SourceCode,
+			},
+			{
+				Name:  "language",
+				Type:  "string",
+				Value: languageConfig,
+			},
+			{
+				Name:  "input",
+				Type:  "string",
+				Value: arg.Input,
+			},
+			{
+				Name:  "timeLimit",
+				Type:  "int",
+				Value: timeLimit,
+			},
+			{
+				Name:  "memoryLimit",
+				Type:  "int",
+				Value: memoryLimit,
+			},
+		},
+	}
+
+	if _, err := gbl.MachineryServer.SendTaskWithContext(ctx, &runTask); err != nil {
+		log.For(ctx).Error("send run task fail", zap.Error(err), zap.String("runID", runID))
+		wrap.SetInternalServerError(c, err)
+		return nil, err
+	}
+	log.For(ctx).Info("send run task success", zap.String("runID", runID))
+
+	return &data.RunInfo{ID: runID}, nil
+}
+
+// get result of run, output, runtime and memory are included,
+// run of other users is treated as not exist
+func GetRunResult(c *gin.Context, runID string) (*judge.OuterResult, error) {
+	ctx := c.Request.Context()
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+	myID := auth.GetUserFromJWT(c).ID
+
+	ownerKey := runOwnerKeyPrefix + runID
+	owner, err := redisCli.Get(ownerKey).Int()
+	if kredis.ErrorHandleAndLog(c, err, true, "get owner of run", ownerKey, runID) != kredis.Success {
+		return nil, err
+	}
+	if owner != myID {
+		log.For(ctx).Error("run belongs to other user", zap.String("runID", runID), zap.Int("owner", owner))
+		_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrNotFoundOrOutOfDate.WithArgs(runID))
+		return nil, kerror.EmptyError
+	}
+
+	k := RunResultKeyPrefix + runID
+	val, err := redisCli.Get(k).Result()
+	if kredis.ErrorHandleAndLog(c, err, true, "get run result", k, runID) != kredis.Success {
+		return nil, err
+	}
+
+	res := judge.OuterResult{}
+	if err := kjson.UnmarshalString(val, &res); err != nil {
+		log.For(ctx).Error("unmarshal fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return nil, err
+	}
+
+	return &res, nil
+}
@@ -33,26 +33,57 @@ import (
 )
 
 const (
+	// name of judge task, the version suffix should be bumped whenever the args
+	// or the result of the task change, so that a judger which doesn't know
+	// the new signature rejects the task instead of misreading the args,
+	// see "judge task" in README.md for the signature
+	JudgeTaskName = "judge_v2"
+)
+
+const (
+	// archived problems and problems of archived group or contest are hidden,
+	// problems of upcoming contest are only visible to owner
 	noOfSql = `
 		select distinct p.* from problem as p,user_in_group as up,user_in_contest as uc 
 		where 
+		p.deleted_at is null and
+		(
 			p.belong_type = 0 or
 			p.owner_id = ? or
 			(p.belong_type = 1 and up.user_id = ? and p.belong_to_id = up.group_id) or
-			(p.belong_type = 2 and uc.user_id = ? and p.belong_to_id = uc.contest_id)
+			(p.belong_type = 2 and uc.user_id = ? and p.belong_to_id = uc.contest_id and
+				p.belong_to_id not in (` + contestOfUpcomingSql + `)) or
+			(p.belong_type = 2 and exists (` + virtualOfContestSql + `))
+		) and
+		p.id not in (` + problemOfArchivedSql + `)
 		`
 	ofTagSql = `
 		select distinct p.* from problem as p,user_in_group as up,user_in_contest as uc,problem_has_tag as pt 
 		where
 		pt.problem_id = p.id and
 		pt.tag_id = ? and
+		p.deleted_at is null and
 		(
 			p.belong_type = 0 or
 			p.owner_id = ? or
 			(p.belong_type = 1 and up.user_id = ? and p.belong_to_id = up.group_id) or
-			(p.belong_type = 2 and uc.user_id = ? and p.belong_to_id = uc.contest_id)
-		)
+			(p.belong_type = 2 and uc.user_id = ? and p.belong_to_id = uc.contest_id and
+				p.belong_to_id not in (` + contestOfUpcomingSql + `)) or
+			(p.belong_type = 2 and exists (` + virtualOfContestSql + `))
+		) and
+		p.id not in (` + problemOfArchivedSql + `)
 		`
+	problemOfArchivedSql = `
+		select ap.id from problem as ap
+		left join ` + "`group`" + ` as ag on ap.belong_type = 1 and ag.id = ap.belong_to_id
+		left join contest as ac on ap.belong_type = 2 and ac.id = ap.belong_to_id
+		where ag.deleted_at is not null or ac.deleted_at is not null
+		`
+	contestOfUpcomingSql = `select uct.id from contest as uct where uct.start_time > ?`
+	// started virtual participation of user, contest of virtual participation has ended
+	virtualOfContestSql = `
+		select 1 from virtual_participation as vp
+		where vp.user_id = ? and vp.contest_id = p.belong_to_id and vp.start_time <= ?`
 )
 
 func GetAllProblemsOfGroup(c *gin.Context, id int) (*gorm.DB, error) {
@@ -71,20 +102,34 @@ func GetAllProblemsOfContest(c *gin.Context, id int) (*gorm.DB, error) {
 	ctx := c.Request.Context()
 	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
 
-	_, err := GetContest(c, id)
+	// virtual participant needn't be participant of contest
+	contest, err := getVirtualContest(c, id)
 	if err != nil {
 		return nil, err
 	}
+	if contest == nil {
+		if contest, err = GetContest(c, id); err != nil {
+			return nil, err
+		}
+	}
+
+	// problems are hidden before contest start
+	if err := checkContestStarted(c, contest); err != nil {
+		return nil, err
+	}
 
-	return db.Joins("join contest on contest.id = problem.belong_to_id and problem.belong_type = 2"), nil
+	return db.Joins("join contest on contest.id = problem.belong_to_id and problem.belong_type = 2 and contest.id = ?", id), nil
 }
 
+// archived problems are filtered by raw sql,
+// so the soft delete condition of gorm is disabled, which can't be combined with raw sql
 func GetAllProblemsOfTag(c *gin.Context, id int) *gorm.DB {
 	ctx := c.Request.Context()
 	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
 	myID := auth.GetUserFromJWT(c).ID
 
-	return db.Raw(ofTagSql, id, myID, myID, myID)
+	now := time.Now()
+	return db.Unscoped().Raw("select * from ("+ofTagSql+") as problem", id, myID, myID, myID, now, myID, now)
 }
 
 func GetAllProblemsOf(c *gin.Context) *gorm.DB {
@@ -92,16 +137,20 @@ func GetAllProblemsOf(c *gin.Context) *gorm.DB {
 	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
 	myID := auth.GetUserFromJWT(c).ID
 
-	return db.Raw(noOfSql, myID, myID, myID)
+	now := time.Now()
+	return db.Unscoped().Raw("select * from ("+noOfSql+") as problem", myID, myID, myID, now, myID, now)
 }
 
-func GetAllProblems(c *gin.Context, page, pageSize int, order string, of string, id int) ([]model.Problem, error) {
+func GetAllProblems(c *gin.Context, spec *data.PageSpec, of string, id int) (*data.PageResult, error) {
 	var err error
 	var problems []model.Problem
 	var db *gorm.DB
 
 	ctx := c.Request.Context()
-	offset := (page - 1) * pageSize
+
+	if err := CheckSort(c, spec.Sorts, problemSortFields); err != nil {
+		return nil, err
+	}
 
 	switch of {
 	case "group":
@@ -118,22 +167,29 @@ func GetAllProblems(c *gin.Context, page, pageSize int, order string, of string,
 		return nil, err
 	}
 
-	queryDB := db.Preload("Tags").Preload("UpVoteUsers", "attitude = ?", model.Up).
-		Preload("DownVoteUsers", "attitude = ?", model.Down).Preload("Catalog").
-		Limit(pageSize).Offset(offset)
-	if order != "" {
-		err = queryDB.Order(order).Find(&problems).Error
-	} else {
-		err = queryDB.Find(&problems).Error
+	total, err := CountRows(c, db.Model(&model.Problem{}), "count problems")
+	if err != nil {
+		return nil, err
 	}
+
+	queryDB := OrderBy(db, spec.Sorts, problemSortFields).
+		Preload("Tags").Preload("UpVoteUsers", "attitude = ?", model.Up).
+		Preload("DownVoteUsers", "attitude = ?", model.Down).Preload("Catalog").
+		Limit(spec.Limit).Offset(spec.Offset)
+	err = queryDB.Find(&problems).Error
 	// error handle
 	if mysql.ErrorHandleAndLog(c, err, true,
 		"get problems", nil) != mysql.Success {
 		return nil, err
 	}
 
+	wraps, err := wrapProblems(c, problems)
+	if err != nil {
+		return nil, err
+	}
+
 	log.For(ctx).Info("success get problems")
-	return problems, nil
+	return NewPageResult(spec, total, wraps), nil
 }
 
 func GetProblem(c *gin.Context, id int, forUpdate bool) (*model.Problem, error) {
@@ -143,7 +199,11 @@ func GetProblem(c *gin.Context, id int, forUpdate bool) (*model.Problem, error)
 	myID := auth.GetUserFromJWT(c).ID
 
 	// get problem
-	queryDB := db.Preload("Tags").Preload("ProblemSamples").Preload("ProblemTestCases").Preload("Owner").
+	// don't query test data, it may be very large
+	queryDB := db.Preload("Tags").Preload("ProblemSamples").Preload("Owner").
+		Preload("ProblemTestCases", func(db *gorm.DB) *gorm.DB {
+			return db.Select(testCaseMetaColumns)
+		}).
 		Preload("UpVoteUsers", "attitude = ?", model.Up).
 		Preload("DownVoteUsers", "attitude = ?", model.Down).
 		Preload("Catalog")
@@ -163,6 +223,17 @@ func GetProblem(c *gin.Context, id int, forUpdate bool) (*model.Problem, error)
 		return nil, err
 	}
 
+	// source of checker and interactor is only visible to owner
+	if problem.OwnerID != myID {
+		problem.CheckerSource = ""
+		problem.InteractorSource = ""
+	}
+
+	// editor should only offer languages can be used
+	if problem.AvailableLanguages, err = getAvailableLanguages(c, &problem); err != nil {
+		return nil, err
+	}
+
 	// if problem is public or problem belong to myself,
 	// return
 	if problem.BelongType == model.BelongToPublic || problem.OwnerID == myID {
@@ -172,8 +243,17 @@ func GetProblem(c *gin.Context, id int, forUpdate bool) (*model.Problem, error)
 	// otherwise, check permission
 	switch problem.BelongType {
 	case model.BelongToContest:
-		// has permission
-		if _, err := GetContest(c, problem.BelongToID); err == nil {
+		// virtual participant of ended contest has permission
+		if contest, err := getVirtualContest(c, problem.BelongToID); err != nil {
+			return nil, err
+		} else if contest != nil {
+			return &problem, nil
+		}
+		// has permission, but statement is hidden before contest start
+		if contest, err := GetContest(c, problem.BelongToID); err == nil {
+			if err := checkContestStarted(c, contest); err != nil {
+				return nil, err
+			}
 			return &problem, nil
 		}
 	case model.BelongToGroup:
@@ -265,6 +345,28 @@ func AddProblem(c *gin.Context, newProblem *model.Problem) error {
 	ctx := c.Request.Context()
 	dbWithAutoUpdate := gbl.DB.Set("gorm:association_autoupdate", true).Set("gorm:association_autocreate", true)
 	db := otgrom.SetSpanToGorm(ctx, dbWithAutoUpdate)
+
+	tx := db.Begin()
+	if err := addProblem(c, tx, newProblem); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err := tx.Commit().Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"commit new problem", newProblem.Name) != mysql.Success {
+		removeTestData(c, testDataKeys(newProblem))
+		return err
+	}
+
+	log.For(ctx).Info("add new problem success",
+		zap.String("problemName", newProblem.Name))
+	return nil
+}
+
+// add problem and its first revision in tx, the caller should commit or rollback tx,
+// test data moved to store is removed when fail
+func addProblem(c *gin.Context, tx *gorm.DB, newProblem *model.Problem) error {
 	oldProblem := model.Problem{}
 
 	//  check unique
@@ -272,31 +374,60 @@ func AddProblem(c *gin.Context, newProblem *model.Problem) error {
 		return fmt.Errorf("check unique fail")
 	}
 
+	// check checker and interactor
+	if err := checkJudgeConfig(c, newProblem); err != nil {
+		return err
+	}
+
+	// check limit of specific languages
+	if err := checkLimits(c, newProblem); err != nil {
+		return err
+	}
+
 	// must clear ids
 	clearTagIDs(newProblem)
 	clearSampleIDs(newProblem)
 	clearTestCaseIDs(newProblem)
+	clearTestDataKeys(newProblem)
 
 	// filter tags
 	if err := filterTags(c, newProblem); err != nil {
 		return err
 	}
 
+	// move large test data to store
+	if _, err := offloadTestCases(c, newProblem); err != nil {
+		return err
+	}
+
 	// add new problem
-	err := db.Create(&newProblem).Error
+	err := tx.Create(&newProblem).Error
 	if mysql.ErrorHandleAndLog(c, err, true,
 		"add new problem", newProblem.Name) != mysql.Success {
+		removeTestData(c, testDataKeys(newProblem))
+		return err
+	}
+
+	// first revision of problem
+	after, err := takeSnapshot(c, tx, newProblem.ID)
+	if err != nil {
+		removeTestData(c, testDataKeys(newProblem))
+		return err
+	}
+	commit := newProblem.CommitMsg
+	if commit == "" {
+		commit = "create problem"
+	}
+	if err := recordRevision(c, tx, newProblem.ID, nil, after, commit); err != nil {
+		removeTestData(c, testDataKeys(newProblem))
 		return err
 	}
 
-	log.For(ctx).Info("add new problem success",
-		zap.String("problemName", newProblem.Name))
 	return nil
 }
 
-func deleteTags(c *gin.Context, problem *model.Problem) error {
+func deleteTags(c *gin.Context, db *gorm.DB, problem *model.Problem) error {
 	ctx := c.Request.Context()
-	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
 	var deleteTagIDs []int
 	var remainTags []model.Tag
 
@@ -324,9 +455,8 @@ func deleteTags(c *gin.Context, problem *model.Problem) error {
 	return nil
 }
 
-func deleteSamples(c *gin.Context, problem *model.Problem) error {
+func deleteSamples(c *gin.Context, db *gorm.DB, problem *model.Problem) error {
 	ctx := c.Request.Context()
-	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
 	var deleteSamplesID []int
 	var remainSamples []model.ProblemSample
 
@@ -399,9 +529,8 @@ func checkSamples(c *gin.Context, problem *model.Problem) error {
 	return nil
 }
 
-func deleteTestCases(c *gin.Context, problem *model.Problem) error {
+func deleteTestCases(c *gin.Context, db *gorm.DB, problem *model.Problem) error {
 	ctx := c.Request.Context()
-	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
 	var deleteTestCasesID []int
 	var remainTestCases []model.ProblemTestCase
 
@@ -531,6 +660,16 @@ func UpdateProblem(c *gin.Context, newProblem *model.Problem) error {
 		return fmt.Errorf("check unique fail")
 	}
 
+	// check checker and interactor
+	if err := checkJudgeConfig(c, newProblem); err != nil {
+		return err
+	}
+
+	// check limit of specific languages
+	if err := checkLimits(c, newProblem); err != nil {
+		return err
+	}
+
 	// check if all sample exist
 	if err := checkSamples(c, newProblem); err != nil {
 		return err
@@ -546,33 +685,86 @@ func UpdateProblem(c *gin.Context, newProblem *model.Problem) error {
 		return err
 	}
 
-	// delete tags which be mark as delete
-	if err := deleteTags(c, newProblem); err != nil {
+	// keep test data which isn't changed
+	if err := fillTestCases(c, newProblem); err != nil {
 		return err
 	}
 
-	// delete samples which be mark as delete
-	if err := deleteSamples(c, newProblem); err != nil {
+	// move large test data to store
+	newKeys, err := offloadTestCases(c, newProblem)
+	if err != nil {
 		return err
 	}
 
-	// delete test cases which be mark as delete
-	if err := deleteTestCases(c, newProblem); err != nil {
+	// update and record revision in one transaction,
+	// new test data in store is removed when fail
+	tx := db.Begin()
+	rollback := func(err error) error {
+		tx.Rollback()
+		removeTestData(c, newKeys)
 		return err
 	}
 
+	// state before update, saved in update log
+	before, err := takeSnapshot(c, tx, newProblem.ID)
+	if err != nil {
+		return rollback(err)
+	}
+
+	// delete tags which be mark as delete
+	if err := deleteTags(c, tx, newProblem); err != nil {
+		return rollback(err)
+	}
+
+	// delete samples which be mark as delete
+	if err := deleteSamples(c, tx, newProblem); err != nil {
+		return rollback(err)
+	}
+
+	// delete test cases which be mark as delete
+	if err := deleteTestCases(c, tx, newProblem); err != nil {
+		return rollback(err)
+	}
+
 	// must clear ids
 	clearTagIDs(newProblem)
 
 	// filter tags
 	if err := filterTags(c, newProblem); err != nil {
-		return err
+		return rollback(err)
 	}
 
 	// update
-	err = db.Model(oldProblem).Updates(newProblem).Error
+	err = tx.Model(oldProblem).Updates(newProblem).Error
 	if mysql.ErrorHandleAndLog(c, err, true,
 		"update problem", newProblem.ID) != mysql.Success {
+		return rollback(err)
+	}
+
+	// zero values are skipped when updating by struct,
+	// empty allowed languages means all languages are allowed, so update it explicitly
+	err = tx.Model(oldProblem).Update("allowed_languages", newProblem.AllowedLanguages).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"update allowed languages of problem", newProblem.ID) != mysql.Success {
+		return rollback(err)
+	}
+	if err := updateJudgeConfig(c, tx, newProblem); err != nil {
+		return rollback(err)
+	}
+
+	// record revision
+	after, err := takeSnapshot(c, tx, newProblem.ID)
+	if err != nil {
+		return rollback(err)
+	}
+	if err := recordRevision(c, tx, newProblem.ID, before, after, newProblem.CommitMsg); err != nil {
+		return rollback(err)
+	}
+
+	err = tx.Commit().Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"commit update of problem", newProblem.ID) != mysql.Success {
+		removeTestData(c, newKeys)
 		return err
 	}
 	log.For(ctx).Info("update problem success", zap.String("problem", newProblem.Name))
@@ -622,31 +814,52 @@ func checkProblemOwner(c *gin.Context, problem *model.Problem) error {
 	return nil
 }
 
-//func DeleteProblem(c *gin.Context, id int) error {
-//	ctx := c.Request.Context()
-//	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
-//
-//	// check if problem exist
-//	problem, err := GetProblem(c, id)
-//	if err != nil {
-//		return err
-//	}
-//
-//	// check owner
-//	if err := checkProblemOwner(c, problem); err != nil {
-//		return err
-//	}
-//	// todo should check have problem under this problem
-//
-//	err = db.Delete(&problem).Error
-//	if mysql.ErrorHandleAndLog(c, err, true,
-//		"delete problem", id) != mysql.Success {
-//		return err
-//	}
-//	log.For(ctx).Info("delete problem success", zap.Int("problemId", id))
-//
-//	return nil
-//}
+// archive problem, submits of problem are kept
+func DeleteProblem(c *gin.Context, id int) error {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	// only owner and administrator can delete problem
+	problem, err := getProblem4Manage(c, id)
+	if err != nil {
+		return err
+	}
+
+	err = db.Delete(problem).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"delete problem", id) != mysql.Success {
+		return err
+	}
+	log.For(ctx).Info("delete problem success", zap.Int("problemId", id))
+
+	return nil
+}
+
+// restore archived problem, only for administrator
+func RestoreProblem(c *gin.Context, id int) error {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	problem := model.Problem{}
+	err := db.Unscoped().Where("deleted_at is not null").First(&problem, id).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get archived problem", id) != mysql.Success {
+		return err
+	}
+
+	// name may be used by another problem after archived
+	if !problemCheckUnique(c, &model.Problem{}, &problem) {
+		return fmt.Errorf("check unique fail")
+	}
+
+	err = db.Unscoped().Model(&problem).Update("deleted_at", nil).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"restore problem", id) != mysql.Success {
+		return err
+	}
+	log.For(ctx).Info("restore problem success", zap.Int("problemId", id))
+
+	return nil
+}
 
 // vote for problem
 func VoteProblem(c *gin.Context, id int, attitude int) error {
@@ -682,31 +895,58 @@ func Submit(c *gin.Context, submitArg *data.SubmitArg) error {
 	myID := auth.GetUserFromJWT(c).ID
 
 	// check if problem exist
-	if _, err := GetProblem(c, submitArg.ProblemID, false); err != nil {
+	problem, err := GetProblem(c, submitArg.ProblemID, false)
+	if err != nil {
+		return err
+	}
+
+	// check if language is allowed by problem or contest
+	if err := checkLanguageAllowed(c, problem, submitArg.Language); err != nil {
 		return err
 	}
 
-	// check if user have running task
+	// check if user have running task,
+	// the result of last submit may not be fetched when it's already complete
 	k := constants.UserProblemSubmitIsCompletePrefix + strconv.Itoa(myID) + "_" + strconv.Itoa(submitArg.ProblemID)
-	err := redisCli.Get(k).Err()
+	val, err := redisCli.Get(k).Result()
 	res := kredis.ErrorHandleAndLog(c, err, false,
 		"check if user has running submit", k, nil)
 	switch res {
 	case kredis.Success:
-		log.For(ctx).Error("user already have running submit", zap.Int("problemID", submitArg.ProblemID))
-		_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).SetMeta(kerror.ErrHaveRunningTask)
-		return kerror.EmptyError
+		if isComplete, _ := strconv.ParseBool(val); !isComplete {
+			log.For(ctx).Error("user already have running submit", zap.Int("problemID", submitArg.ProblemID))
+			_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).SetMeta(kerror.ErrHaveRunningTask)
+			return kerror.EmptyError
+		}
 	case kredis.DB_ERROR:
 		return err
 	case kredis.NotFound:
 		break // continue
 	}
 
+	// resolve limit before submit is saved, so that invalid limit doesn't leave a judging submit
+	lang, err := getLanguage(c, submitArg.Language)
+	if err != nil {
+		return err
+	}
+	if _, _, err := resolveLimit(problem, lang); err != nil {
+		log.For(ctx).Error("parse limit of problem fail", zap.Int("problemID", problem.ID), zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return err
+	}
+
+	// submit after contest ended isn't counted in scoreboard
+	outOfContest, err := isOutOfContest(c, problem)
+	if err != nil {
+		return err
+	}
+
 	submit := model.Submit{
-		ProblemID:  submitArg.ProblemID,
-		UserID:     myID,
-		SourceCode: submitArg.SourceCode,
-		Language:   submitArg.Language,
+		ProblemID:    submitArg.ProblemID,
+		UserID:       myID,
+		SourceCode:   submitArg.SourceCode,
+		Language:     submitArg.Language,
+		OutOfContest: outOfContest,
 	}
 
 	err = db.Save(&submit).Error
@@ -715,8 +955,18 @@ func Submit(c *gin.Context, submitArg *data.SubmitArg) error {
 		return err
 	}
 
+	// track submit to collect its result
+	judging := []data.JudgingSubmit{{SubmitID: submit.ID, SentAt: time.Now()}}
+	if err := trackJudging(c, judging); err != nil {
+		return err
+	}
+
 	// submit to judger
-	if err := submit2Judger(c, submit.ID); err != nil {
+	fullJudge, err := needFullJudge(c, problem)
+	if err != nil {
+		return err
+	}
+	if err := submit2Judger(c, &submit, problem, fullJudge); err != nil {
 		return err
 	}
 
@@ -730,29 +980,144 @@ func Submit(c *gin.Context, submitArg *data.SubmitArg) error {
 	return nil
 }
 
-// submit to judger
-func submit2Judger(c *gin.Context, submitID int) error {
+// the judger should run all test cases instead of stopping at
+// the first failed one when problem belong to an OI style contest,
+// and report id of passed test cases in passed_cases of result,
+// so that the passed test cases can be used to calculate score
+func needFullJudge(c *gin.Context, problem *model.Problem) (bool, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	if problem.BelongType != model.BelongToContest {
+		return false, nil
+	}
+
+	// contest may be archived
+	contest := model.Contest{}
+	err := db.Unscoped().First(&contest, problem.BelongToID).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get contest of problem", problem.BelongToID) != mysql.Success {
+		return false, err
+	}
+
+	return contest.ScoreMode != model.ScoreModeACM, nil
+}
+
+// submit to judger,
+// the args are sent in order of JudgeTaskName signature documented in README.md
+func submit2Judger(c *gin.Context, submit *model.Submit, problem *model.Problem, fullJudge bool) error {
 	bgCtx := c.Request.Context()
 	span, ctx := opentracing.StartSpanFromContext(bgCtx, "sendTask")
 	defer span.Finish()
 
+	lang, err := getLanguage(c, submit.Language)
+	if err != nil {
+		return err
+	}
+	languageConfig, err := kjson.MarshalString(lang)
+	if err != nil {
+		log.For(ctx).Error("marshal json fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return err
+	}
+	timeLimit, memoryLimit, err := resolveLimit(problem, lang)
+	if err != nil {
+		log.For(ctx).Error("parse limit of problem fail", zap.Int("problemID", problem.ID), zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return err
+	}
+
+	checker, interactor, err := getJudgeConfig(c, problem.ID)
+	if err != nil {
+		return err
+	}
+	checkerConfig, err := kjson.MarshalString(checker)
+	if err != nil {
+		log.For(ctx).Error("marshal json fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return err
+	}
+
+	// empty for traditional problem
+	problemType, interactorConfig := model.TraditionalProblem, ""
+	if interactor != nil {
+		problemType = model.InteractiveProblem
+		if interactorConfig, err = kjson.MarshalString(interactor); err != nil {
+			log.For(ctx).Error("marshal json fail", zap.Error(err))
+			wrap.SetInternalServerError(c, err)
+			return err
+		}
+	}
+
+	// only send references of test cases
+	refs, err := getTestCaseRefs(c, problem.ID)
+	if err != nil {
+		return err
+	}
+	testCases, err := kjson.MarshalString(refs)
+	if err != nil {
+		log.For(ctx).Error("marshal json fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return err
+	}
+
 	judgeTask := tasks.Signature{
-		Name: "judge",
+		Name: JudgeTaskName,
 		Args: []tasks.Arg{
 			{
 				Name:  "submitId",
 				Type:  "int",
-				Value: submitID,
+				Value: submit.ID,
+			},
+			{
+				Name:  "fullJudge",
+				Type:  "bool",
+				Value: fullJudge,
+			},
+			{
+				Name:  "language",
+				Type:  "string",
+				Value: languageConfig,
+			},
+			{
+				Name:  "timeLimit",
+				Type:  "int",
+				Value: timeLimit,
+			},
+			{
+				Name:  "memoryLimit",
+				Type:  "int",
+				Value: memoryLimit,
+			},
+			{
+				Name:  "testCases",
+				Type:  "string",
+				Value: testCases,
+			},
+			{
+				Name:  "checker",
+				Type:  "string",
+				Value: checkerConfig,
+			},
+			{
+				Name:  "problemType",
+				Type:  "int",
+				Value: int(problemType),
+			},
+			{
+				Name:  "interactor",
+				Type:  "string",
+				Value: interactorConfig,
 			},
 		},
 	}
 
 	if _, err := gbl.MachineryServer.SendTaskWithContext(ctx, &judgeTask); err != nil {
-		log.For(ctx).Error("send async job fail", zap.Error(err), zap.Int("submitID", submitID))
+		log.For(ctx).Error("send async job fail", zap.Error(err), zap.Int("submitID", submit.ID))
 		wrap.SetInternalServerError(c, err)
 		return err
 	}
-	log.For(ctx).Info("send async jos success", zap.Int("submitID", submitID))
+	log.For(ctx).Info("send async jos success", zap.Int("submitID", submit.ID))
 
 	return nil
 }
@@ -857,17 +1222,13 @@ func GetResult(c *gin.Context, problemID int) (*judge.OuterResult, error) {
 		return nil, err
 	}
 
-	// return result and delete redis key
+	// return result and delete redis key,
+	// the result is kept until timeout, so that its detail can be collected
 	err = redisCli.Del(isCompleteKey).Err()
 	if kredis.ErrorHandleAndLog(c, err, true,
 		"remove the run result of submit", isCompleteKey, nil) != kredis.Success {
 		return nil, err
 	}
-	err = redisCli.Del(resultKey).Err()
-	if kredis.ErrorHandleAndLog(c, err, true,
-		"remove the run result of submit", resultKey, nil) != kredis.Success {
-		return nil, err
-	}
 
 	return &result, nil
 }
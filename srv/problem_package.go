@@ -0,0 +1,506 @@
+package srv
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/si9ma/KillOJ-backend/auth"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/kerror"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/si9ma/KillOJ-common/mysql"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	packageManifest         = "problem.json"
+	packageCheckerSource    = "checker/source"
+	packageInteractorSource = "interactor/source"
+	maxPackageFileSize      = 64 << 20  // 64MB, for every file in package
+	maxPackageSize          = 256 << 20 // 256MB, for all files in package, uncompressed
+)
+
+func ExportProblem(c *gin.Context, id int) ([]byte, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	// only owner and administrator can export,
+	// because test cases are exported
+	if _, err := getProblem4Manage(c, id); err != nil {
+		return nil, err
+	}
+
+	problem := model.Problem{}
+	err := db.Preload("Tags").Preload("ProblemSamples").Preload("ProblemTestCases").
+		Preload("Catalog").First(&problem, id).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get problem to export", id) != mysql.Success {
+		return nil, err
+	}
+
+	for i := range problem.ProblemTestCases {
+		if err := loadTestData(c, &problem.ProblemTestCases[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := packProblem(&problem)
+	if err != nil {
+		log.For(ctx).Error("pack problem fail", zap.Error(err), zap.Int("problemID", id))
+		wrap.SetInternalServerError(c, err)
+		return nil, err
+	}
+
+	log.For(ctx).Info("export problem success", zap.Int("problemID", id))
+	return res, nil
+}
+
+// import problems from package, a fps xml may contain multiple problems
+func ImportProblems(c *gin.Context, arg *data.ImportProblemArg) ([]model.Problem, error) {
+	var problems []model.Problem
+	file := arg.File
+
+	ctx := c.Request.Context()
+	dbWithAutoUpdate := gbl.DB.Set("gorm:association_autoupdate", true).Set("gorm:association_autocreate", true)
+	db := otgrom.SetSpanToGorm(ctx, dbWithAutoUpdate)
+	myID := auth.GetUserFromJWT(c).ID
+
+	// guess format from file name
+	format := arg.Format
+	if format == "" {
+		format = data.PackageFormatKillOJ
+		if strings.EqualFold(path.Ext(file.Filename), ".xml") {
+			format = data.PackageFormatFPS
+		}
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		log.For(ctx).Error("open upload file fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return nil, err
+	}
+	defer f.Close()
+
+	switch format {
+	case data.PackageFormatFPS:
+		var content []byte
+		if content, err = readLimited(f, maxPackageSize, file.Filename); err == nil {
+			problems, err = parseFPS(content)
+		}
+	default:
+		var r *zip.Reader
+		var problem *model.Problem
+		if r, err = zip.NewReader(f, file.Size); err == nil {
+			if problem, err = unpackProblem(r); err == nil {
+				problems = append(problems, *problem)
+			}
+		}
+	}
+	if err != nil {
+		log.For(ctx).Error("parse problem package fail", zap.Error(err),
+			zap.String("format", format), zap.String("file", file.Filename))
+		_ = c.Error(err).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrInvalidPackage.WithArgs(err.Error()))
+		return nil, err
+	}
+
+	for i := range problems {
+		problem := &problems[i]
+		if len(problem.ProblemTestCases) == 0 {
+			log.For(ctx).Error("one problem at least have one test case", zap.String("problem", problem.Name))
+			_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
+				SetMeta(kerror.ErrAtLeast.WithArgs(1, "test case"))
+			return nil, kerror.EmptyError
+		}
+
+		if err := resolveCatalog(c, problem, arg.CatalogID); err != nil {
+			return nil, err
+		}
+
+		problem.OwnerID = myID
+		problem.BelongType = arg.BelongType
+		problem.BelongToID = arg.BelongToID
+
+		// problem in package isn't bound from request
+		if !wrap.Validate(c, problem) {
+			return nil, fmt.Errorf("validate problem %s fail", problem.Name)
+		}
+	}
+
+	// all problems are imported, or none of them
+	tx := db.Begin()
+	for i := range problems {
+		if err := addProblem(c, tx, &problems[i]); err != nil {
+			tx.Rollback()
+			for j := 0; j < i; j++ {
+				removeTestData(c, testDataKeys(&problems[j]))
+			}
+			return nil, err
+		}
+	}
+	err = tx.Commit().Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"commit imported problems", file.Filename) != mysql.Success {
+		for i := range problems {
+			removeTestData(c, testDataKeys(&problems[i]))
+		}
+		return nil, err
+	}
+
+	log.For(ctx).Info("import problems success", zap.Int("num", len(problems)))
+	return problems, nil
+}
+
+// find catalog by name, use default catalog when not exist
+func resolveCatalog(c *gin.Context, problem *model.Problem, defaultID int) error {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	name := problem.Catalog.Name
+	problem.Catalog = model.Catalog{}
+	problem.CatalogID = defaultID
+
+	if name != "" {
+		catalog := model.Catalog{}
+		err := db.Where("name = ?", name).First(&catalog).Error
+		switch mysql.ErrorHandleAndLog(c, err, false, "get catalog by name", name) {
+		case mysql.Success:
+			problem.CatalogID = catalog.ID
+			return nil
+		case mysql.DB_ERROR:
+			return err
+		}
+	}
+
+	if defaultID == 0 {
+		err := fmt.Errorf("catalog of problem not exist")
+		log.For(ctx).Error("catalog of problem not exist", zap.String("catalog", name))
+		_ = c.Error(err).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrNotExist.WithArgs("catalog " + name))
+		return err
+	}
+
+	// check default catalog
+	err := db.First(&model.Catalog{}, defaultID).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get catalog", defaultID) != mysql.Success {
+		return err
+	}
+
+	return nil
+}
+
+// pack problem to killoj zip package
+func packProblem(problem *model.Problem) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+
+	pkg := data.ProblemPackage{
+		Version:     data.PackageVersion,
+		Name:        problem.Name,
+		Desc:        problem.Desc,
+		Input:       problem.Input,
+		Output:      problem.Output,
+		Hint:        problem.Hint,
+		Source:      problem.Source,
+		TimeLimit:   problem.TimeLimit,
+		MemoryLimit: problem.MemoryLimit,
+		Difficulty:  problem.Difficulty,
+		Limit:       problem.Limit,
+		Languages:   problem.AllowedLanguages,
+		Catalog:     problem.Catalog.Name,
+	}
+	for _, tag := range problem.Tags {
+		pkg.Tags = append(pkg.Tags, tag.Name)
+	}
+
+	writeFile := func(name string, content string) error {
+		fw, err := w.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(fw, content)
+		return err
+	}
+
+	for i, sample := range problem.ProblemSamples {
+		files := data.PackageCaseFiles{
+			Input:  "samples/" + strconv.Itoa(i+1) + ".in",
+			Output: "samples/" + strconv.Itoa(i+1) + ".out",
+		}
+		if err := writeFile(files.Input, sample.Input); err != nil {
+			return nil, err
+		}
+		if err := writeFile(files.Output, sample.Output); err != nil {
+			return nil, err
+		}
+		pkg.Samples = append(pkg.Samples, files)
+	}
+
+	for i, testCase := range problem.ProblemTestCases {
+		files := data.PackageCaseFiles{
+			Input:  "tests/" + strconv.Itoa(i+1) + ".in",
+			Output: "tests/" + strconv.Itoa(i+1) + ".out",
+			Weight: testCase.Weight,
+		}
+		if err := writeFile(files.Input, testCase.InputData); err != nil {
+			return nil, err
+		}
+		if err := writeFile(files.Output, testCase.ExpectedOutput); err != nil {
+			return nil, err
+		}
+		pkg.TestCases = append(pkg.TestCases, files)
+	}
+
+	if problem.CheckerType != model.ExactChecker {
+		pkg.Checker = &data.PackageChecker{
+			Type:           problem.CheckerType,
+			FloatTolerance: problem.FloatTolerance,
+			Language:       problem.CheckerLanguage,
+		}
+		if problem.CheckerSource != "" {
+			pkg.Checker.Source = packageCheckerSource
+			if err := writeFile(pkg.Checker.Source, problem.CheckerSource); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	pkg.Type = problem.Type
+	if problem.Type == model.InteractiveProblem {
+		pkg.Interactor = &data.PackageInteractor{
+			Source:   packageInteractorSource,
+			Language: problem.InteractorLanguage,
+		}
+		if err := writeFile(pkg.Interactor.Source, problem.InteractorSource); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest, err := json.MarshalIndent(pkg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(packageManifest, string(manifest)); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// read all content from r, fail if it's larger than limit
+func readLimited(r io.Reader, limit int64, name string) ([]byte, error) {
+	content, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("%s is too large", name)
+	}
+	return content, nil
+}
+
+// unpack problem from killoj zip package,
+// the catalog name is stored in problem.Catalog.Name
+func unpackProblem(r *zip.Reader) (*model.Problem, error) {
+	files := make(map[string]*zip.File)
+	for _, f := range r.File {
+		files[path.Clean(f.Name)] = f
+	}
+
+	// budget is shared by all files read from package,
+	// the declared size in zip header can't be trusted, so count the bytes actually read
+	budget := int64(maxPackageSize)
+	readFile := func(name string) (string, error) {
+		f, ok := files[path.Clean(name)]
+		if !ok {
+			return "", fmt.Errorf("%s not found", name)
+		}
+		if f.UncompressedSize64 > maxPackageFileSize || int64(f.UncompressedSize64) > budget {
+			return "", fmt.Errorf("%s is too large", name)
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+
+		limit := int64(maxPackageFileSize)
+		if budget < limit {
+			limit = budget
+		}
+		content, err := readLimited(rc, limit, name)
+		if err != nil {
+			return "", err
+		}
+		budget -= int64(len(content))
+		return string(content), nil
+	}
+
+	manifest, err := readFile(packageManifest)
+	if err != nil {
+		return nil, err
+	}
+	pkg := data.ProblemPackage{}
+	if err := json.Unmarshal([]byte(manifest), &pkg); err != nil {
+		return nil, fmt.Errorf("%s is broken: %v", packageManifest, err)
+	}
+	if pkg.Version > data.PackageVersion {
+		return nil, fmt.Errorf("version %d is not supported", pkg.Version)
+	}
+	if pkg.Name == "" {
+		return nil, fmt.Errorf("name of problem is empty")
+	}
+
+	problem := model.Problem{
+		Name:             pkg.Name,
+		Desc:             pkg.Desc,
+		Input:            pkg.Input,
+		Output:           pkg.Output,
+		Hint:             pkg.Hint,
+		Source:           pkg.Source,
+		TimeLimit:        pkg.TimeLimit,
+		MemoryLimit:      pkg.MemoryLimit,
+		Difficulty:       pkg.Difficulty,
+		Limit:            pkg.Limit,
+		AllowedLanguages: pkg.Languages,
+		Catalog:          model.Catalog{Name: pkg.Catalog},
+	}
+	if problem.Limit.IsNull() {
+		problem.Limit = model.JSON("[]")
+	}
+	for _, name := range pkg.Tags {
+		problem.Tags = append(problem.Tags, model.Tag{Name: name})
+	}
+
+	for _, sample := range pkg.Samples {
+		input, err := readFile(sample.Input)
+		if err != nil {
+			return nil, err
+		}
+		output, err := readFile(sample.Output)
+		if err != nil {
+			return nil, err
+		}
+		problem.ProblemSamples = append(problem.ProblemSamples, model.ProblemSample{
+			Input:  input,
+			Output: output,
+		})
+	}
+
+	for _, testCase := range pkg.TestCases {
+		input, err := readFile(testCase.Input)
+		if err != nil {
+			return nil, err
+		}
+		output, err := readFile(testCase.Output)
+		if err != nil {
+			return nil, err
+		}
+		problem.ProblemTestCases = append(problem.ProblemTestCases, model.ProblemTestCase{
+			InputData:      input,
+			ExpectedOutput: output,
+			Weight:         testCase.Weight,
+		})
+	}
+
+	if pkg.Checker != nil {
+		problem.CheckerType = pkg.Checker.Type
+		problem.FloatTolerance = pkg.Checker.FloatTolerance
+		problem.CheckerLanguage = pkg.Checker.Language
+		if pkg.Checker.Source != "" {
+			if problem.CheckerSource, err = readFile(pkg.Checker.Source); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	problem.Type = pkg.Type
+	if pkg.Interactor != nil {
+		problem.InteractorLanguage = pkg.Interactor.Language
+		if problem.InteractorSource, err = readFile(pkg.Interactor.Source); err != nil {
+			return nil, err
+		}
+	}
+
+	return &problem, nil
+}
+
+// parse problems from HUSTOJ free problem set xml
+func parseFPS(content []byte) ([]model.Problem, error) {
+	var problems []model.Problem
+
+	fps := data.FPS{}
+	if err := xml.Unmarshal(content, &fps); err != nil {
+		return nil, err
+	}
+	if len(fps.Items) == 0 {
+		return nil, fmt.Errorf("no problem found")
+	}
+
+	for _, item := range fps.Items {
+		if strings.TrimSpace(item.Title) == "" {
+			return nil, fmt.Errorf("title of problem is empty")
+		}
+		if len(item.SampleInputs) != len(item.SampleOutputs) {
+			return nil, fmt.Errorf("samples of %s are not paired", item.Title)
+		}
+		if len(item.TestInputs) != len(item.TestOutputs) {
+			return nil, fmt.Errorf("test cases of %s are not paired", item.Title)
+		}
+
+		// default unit of time limit is second, memory limit is MB
+		timeLimit := item.TimeLimit.Value * 1000
+		if strings.EqualFold(item.TimeLimit.Unit, "ms") {
+			timeLimit = item.TimeLimit.Value
+		}
+		memoryLimit := item.MemoryLimit.Value * 1024
+		if strings.EqualFold(item.MemoryLimit.Unit, "kb") {
+			memoryLimit = item.MemoryLimit.Value
+		}
+
+		problem := model.Problem{
+			Name:        strings.TrimSpace(item.Title),
+			Desc:        item.Description,
+			Input:       item.Input,
+			Output:      item.Output,
+			Hint:        item.Hint,
+			Source:      item.Source,
+			TimeLimit:   int(timeLimit),
+			MemoryLimit: int(memoryLimit),
+			Limit:       model.JSON("[]"),
+		}
+		for i := range item.SampleInputs {
+			problem.ProblemSamples = append(problem.ProblemSamples, model.ProblemSample{
+				Input:  item.SampleInputs[i],
+				Output: item.SampleOutputs[i],
+			})
+		}
+		for i := range item.TestInputs {
+			problem.ProblemTestCases = append(problem.ProblemTestCases, model.ProblemTestCase{
+				InputData:      item.TestInputs[i],
+				ExpectedOutput: item.TestOutputs[i],
+			})
+		}
+
+		problems = append(problems, problem)
+	}
+
+	return problems, nil
+}
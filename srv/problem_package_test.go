@@ -0,0 +1,98 @@
+package srv
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackProblem(t *testing.T) {
+	problem := &model.Problem{
+		Name:          "a+b",
+		Desc:          "calculate a+b",
+		TimeLimit:     1000,
+		MemoryLimit:   65536,
+		Difficulty:    model.Medium,
+		Limit:         model.JSON(`[]`),
+		Catalog:       model.Catalog{Name: "math"},
+		Tags:          []model.Tag{{Name: "easy"}},
+		CheckerType:   model.SpecialChecker,
+		CheckerSource: "int main() {}",
+		ProblemSamples: []model.ProblemSample{
+			{Input: "1 2", Output: "3"},
+		},
+		ProblemTestCases: []model.ProblemTestCase{
+			{InputData: "1 2", ExpectedOutput: "3", Weight: 2},
+			{InputData: "3 4", ExpectedOutput: "7"},
+		},
+	}
+
+	res, err := packProblem(problem)
+	assert.NoError(t, err)
+
+	r, err := zip.NewReader(bytes.NewReader(res), int64(len(res)))
+	assert.NoError(t, err)
+	unpacked, err := unpackProblem(r)
+	assert.NoError(t, err)
+
+	assert.Equal(t, problem.Name, unpacked.Name)
+	assert.Equal(t, problem.TimeLimit, unpacked.TimeLimit)
+	assert.Equal(t, problem.Difficulty, unpacked.Difficulty)
+	assert.Equal(t, "math", unpacked.Catalog.Name)
+	assert.Equal(t, "easy", unpacked.Tags[0].Name)
+	assert.Equal(t, model.SpecialChecker, unpacked.CheckerType)
+	assert.Equal(t, problem.CheckerSource, unpacked.CheckerSource)
+	assert.Equal(t, problem.ProblemSamples, unpacked.ProblemSamples)
+	assert.Equal(t, problem.ProblemTestCases, unpacked.ProblemTestCases)
+}
+
+func TestParseFPS(t *testing.T) {
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<fps version="1.2">
+	<item>
+		<title><![CDATA[A+B]]></title>
+		<time_limit unit="s"><![CDATA[1]]></time_limit>
+		<memory_limit unit="mb"><![CDATA[128]]></memory_limit>
+		<description><![CDATA[<p>calculate a+b</p>]]></description>
+		<sample_input><![CDATA[1 2]]></sample_input>
+		<sample_output><![CDATA[3]]></sample_output>
+		<test_input><![CDATA[1 2]]></test_input>
+		<test_output><![CDATA[3]]></test_output>
+		<test_input><![CDATA[3 4]]></test_input>
+		<test_output><![CDATA[7]]></test_output>
+	</item>
+	<item>
+		<title>B</title>
+		<time_limit unit="ms">500</time_limit>
+		<memory_limit unit="kb">1024</memory_limit>
+		<test_input>1</test_input>
+		<test_output>1</test_output>
+	</item>
+</fps>`
+
+	problems, err := parseFPS([]byte(content))
+	assert.NoError(t, err)
+	assert.Len(t, problems, 2)
+	assert.Equal(t, "A+B", problems[0].Name)
+	assert.Equal(t, 1000, problems[0].TimeLimit)
+	assert.Equal(t, 128*1024, problems[0].MemoryLimit)
+	assert.Len(t, problems[0].ProblemSamples, 1)
+	assert.Len(t, problems[0].ProblemTestCases, 2)
+	assert.Equal(t, 500, problems[1].TimeLimit)
+	assert.Equal(t, 1024, problems[1].MemoryLimit)
+
+	_, err = parseFPS([]byte(`<fps><item><title>C</title><test_input>1</test_input></item></fps>`))
+	assert.Error(t, err)
+}
+
+func TestReadLimited(t *testing.T) {
+	content, err := readLimited(bytes.NewReader([]byte("1234")), 4, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "1234", string(content))
+
+	_, err = readLimited(bytes.NewReader([]byte("12345")), 4, "a")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,527 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/si9ma/KillOJ-backend/auth"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/kerror"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/si9ma/KillOJ-common/mysql"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+// snapshot of problem in db, include keys of test data in store
+func takeSnapshot(c *gin.Context, db *gorm.DB, id int) (*data.ProblemSnapshot, error) {
+	orderByID := func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}
+
+	problem := model.Problem{}
+	err := db.Preload("Tags").Preload("ProblemSamples", orderByID).
+		Preload("ProblemTestCases", orderByID).First(&problem, id).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get problem for snapshot", id) != mysql.Success {
+		return nil, err
+	}
+
+	snapshot := data.ProblemSnapshot{
+		Name:               problem.Name,
+		Desc:               problem.Desc,
+		Input:              problem.Input,
+		Output:             problem.Output,
+		Hint:               problem.Hint,
+		Source:             problem.Source,
+		TimeLimit:          problem.TimeLimit,
+		MemoryLimit:        problem.MemoryLimit,
+		Difficulty:         problem.Difficulty,
+		CatalogID:          problem.CatalogID,
+		Limit:              problem.Limit,
+		AllowedLanguages:   problem.AllowedLanguages,
+		CheckerType:        problem.CheckerType,
+		FloatTolerance:     problem.FloatTolerance,
+		CheckerSource:      problem.CheckerSource,
+		CheckerLanguage:    problem.CheckerLanguage,
+		Type:               problem.Type,
+		InteractorSource:   problem.InteractorSource,
+		InteractorLanguage: problem.InteractorLanguage,
+		Samples:            problem.ProblemSamples,
+		TestCases:          problem.ProblemTestCases,
+	}
+	for _, tag := range problem.Tags {
+		snapshot.Tags = append(snapshot.Tags, tag.Name)
+	}
+
+	// inline test data is saved to store, only keys are kept in snapshot,
+	// so that update log doesn't grow with test data
+	for i := range snapshot.TestCases {
+		testCase := &snapshot.TestCases[i]
+		if testCase.InputKey == "" {
+			key, size, sum, err := putSnapshotData(c, testCase.InputData)
+			if err != nil {
+				return nil, err
+			}
+			testCase.InputData, testCase.InputKey, testCase.InputSize, testCase.InputSum = "", key, size, sum
+		}
+		if testCase.OutputKey == "" {
+			key, size, sum, err := putSnapshotData(c, testCase.ExpectedOutput)
+			if err != nil {
+				return nil, err
+			}
+			testCase.ExpectedOutput, testCase.OutputKey, testCase.OutputSize, testCase.OutputSum = "", key, size, sum
+		}
+	}
+
+	return &snapshot, nil
+}
+
+// save revision to update log, before is nil when problem is created
+func recordRevision(c *gin.Context, db *gorm.DB, problemID int, before, after *data.ProblemSnapshot, commit string) error {
+	ctx := c.Request.Context()
+
+	updateLog := model.ProblemUpdateLog{
+		UserID:    auth.GetUserFromJWT(c).ID,
+		ProblemID: problemID,
+		Commit:    commit,
+	}
+	for _, item := range []struct {
+		snapshot *data.ProblemSnapshot
+		to       *string
+	}{{before, &updateLog.BeforeLog}, {after, &updateLog.AfterLog}} {
+		if item.snapshot == nil {
+			continue
+		}
+		res, err := json.Marshal(item.snapshot)
+		if err != nil {
+			log.For(ctx).Error("marshal json fail", zap.Error(err))
+			wrap.SetInternalServerError(c, err)
+			return err
+		}
+		*item.to = string(res)
+	}
+
+	err := db.Create(&updateLog).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"save update log of problem", problemID) != mysql.Success {
+		return err
+	}
+
+	// test data replaced or deleted is only referenced by revisions now
+	markTestDataGarbage(c, removedTestDataKeys(before, after))
+
+	log.For(ctx).Info("record revision of problem success",
+		zap.Int("problemID", problemID), zap.Int("logID", updateLog.LogID))
+	return nil
+}
+
+// keys of test data in store which are in before but not in after
+func removedTestDataKeys(before, after *data.ProblemSnapshot) []string {
+	var keys []string
+	if before == nil {
+		return keys
+	}
+
+	exist := make(map[string]bool)
+	for _, testCase := range after.TestCases {
+		exist[testCase.InputKey], exist[testCase.OutputKey] = true, true
+	}
+	for _, testCase := range before.TestCases {
+		for _, key := range []string{testCase.InputKey, testCase.OutputKey} {
+			if key != "" && !exist[key] {
+				keys = append(keys, key)
+				exist[key] = true
+			}
+		}
+	}
+
+	return keys
+}
+
+// get all revisions of problem, snapshots are not returned
+func GetRevisions(c *gin.Context, id int) ([]model.ProblemUpdateLog, error) {
+	var revisions []model.ProblemUpdateLog
+
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	if _, err := getProblem4Manage(c, id); err != nil {
+		return nil, err
+	}
+
+	err := db.Select("log_id, user_id, problem_id, commit, created_at").Preload("User").
+		Where("problem_id = ?", id).Order("log_id desc").Find(&revisions).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get revisions of problem", id) != mysql.Success {
+		return nil, err
+	}
+
+	log.For(ctx).Info("success get revisions of problem", zap.Int("problemID", id))
+	return revisions, nil
+}
+
+func getRevision(c *gin.Context, problemID int, logID int) (*model.ProblemUpdateLog, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	revision := model.ProblemUpdateLog{}
+	err := db.Where("problem_id = ?", problemID).First(&revision, logID).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get revision of problem", logID) != mysql.Success {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+// parse snapshot in update log, return nil when log is empty
+func parseSnapshot(c *gin.Context, logID int, content string) (*data.ProblemSnapshot, error) {
+	ctx := c.Request.Context()
+
+	if content == "" {
+		return nil, nil
+	}
+
+	snapshot := data.ProblemSnapshot{}
+	if err := json.Unmarshal([]byte(content), &snapshot); err != nil {
+		log.For(ctx).Error("unmarshal snapshot of revision fail", zap.Int("logID", logID), zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+// diff state of problem after two revisions,
+// diff with the state before revision To when From is 0
+func DiffRevisions(c *gin.Context, id int, arg *data.RevisionDiffArg) (*data.RevisionDiff, error) {
+	ctx := c.Request.Context()
+
+	if _, err := getProblem4Manage(c, id); err != nil {
+		return nil, err
+	}
+
+	to, err := getRevision(c, id, arg.To)
+	if err != nil {
+		return nil, err
+	}
+	after, err := parseSnapshot(c, to.LogID, to.AfterLog)
+	if err != nil {
+		return nil, err
+	}
+
+	var before *data.ProblemSnapshot
+	if arg.From == 0 {
+		if before, err = parseSnapshot(c, to.LogID, to.BeforeLog); err != nil {
+			return nil, err
+		}
+	} else {
+		from, err := getRevision(c, id, arg.From)
+		if err != nil {
+			return nil, err
+		}
+		if before, err = parseSnapshot(c, from.LogID, from.AfterLog); err != nil {
+			return nil, err
+		}
+	}
+
+	changes, err := diffSnapshot(before, after)
+	if err != nil {
+		log.For(ctx).Error("diff revisions fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return nil, err
+	}
+
+	return &data.RevisionDiff{
+		From:    arg.From,
+		To:      arg.To,
+		Changes: changes,
+	}, nil
+}
+
+// restore problem to the state after revision, rollback is recorded as a new revision
+func RollbackProblem(c *gin.Context, id int, logID int, arg *data.RollbackArg) error {
+	ctx := c.Request.Context()
+	dbWithAutoUpdate := gbl.DB.Set("gorm:association_autoupdate", true).Set("gorm:association_autocreate", true)
+	db := otgrom.SetSpanToGorm(ctx, dbWithAutoUpdate)
+
+	problem, err := getProblem4Manage(c, id)
+	if err != nil {
+		return err
+	}
+
+	revision, err := getRevision(c, id, logID)
+	if err != nil {
+		return err
+	}
+	target, err := parseSnapshot(c, revision.LogID, revision.AfterLog)
+	if err != nil {
+		return err
+	}
+	if target == nil || len(target.TestCases) == 0 {
+		err := fmt.Errorf("revision %d has no test case", logID)
+		log.For(ctx).Error("can't rollback to revision without test case", zap.Int("logID", logID))
+		_ = c.Error(err).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrAtLeast.WithArgs(1, "test case"))
+		return err
+	}
+
+	// name may be used by another problem after revision
+	if !problemCheckUnique(c, problem, &model.Problem{Name: target.Name}) {
+		return fmt.Errorf("check unique fail")
+	}
+
+	// filter tags
+	tagProblem := model.Problem{}
+	for _, name := range target.Tags {
+		tagProblem.Tags = append(tagProblem.Tags, model.Tag{Name: name})
+	}
+	if err := filterTags(c, &tagProblem); err != nil {
+		return err
+	}
+
+	tx := db.Begin()
+	rollback := func(err error, desc string) error {
+		mysql.ErrorHandleAndLog(c, err, true, desc, id)
+		tx.Rollback()
+		return err
+	}
+
+	before, err := takeSnapshot(c, tx, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Model(&model.Problem{ID: id}).Updates(map[string]interface{}{
+		"name":                target.Name,
+		"desc":                target.Desc,
+		"input":               target.Input,
+		"output":              target.Output,
+		"hint":                target.Hint,
+		"source":              target.Source,
+		"time_limit":          target.TimeLimit,
+		"memory_limit":        target.MemoryLimit,
+		"difficulty":          target.Difficulty,
+		"catalog_id":          target.CatalogID,
+		"limit":               target.Limit,
+		"allowed_languages":   target.AllowedLanguages,
+		"checker_type":        target.CheckerType,
+		"float_tolerance":     target.FloatTolerance,
+		"checker_source":      target.CheckerSource,
+		"checker_language":    target.CheckerLanguage,
+		"type":                target.Type,
+		"interactor_source":   target.InteractorSource,
+		"interactor_language": target.InteractorLanguage,
+	}).Error
+	if err != nil {
+		return rollback(err, "rollback fields of problem")
+	}
+
+	err = tx.Model(&model.Problem{ID: id}).Association("Tags").Replace(tagProblem.Tags).Error
+	if err != nil {
+		return rollback(err, "rollback tags of problem")
+	}
+
+	// samples are recreated
+	err = tx.Where("problem_id = ?", id).Delete(&model.ProblemSample{}).Error
+	if err != nil {
+		return rollback(err, "delete samples of problem")
+	}
+	for _, sample := range target.Samples {
+		sample.ID, sample.ProblemID = 0, id
+		if err := tx.Create(&sample).Error; err != nil {
+			return rollback(err, "rollback samples of problem")
+		}
+	}
+
+	// test cases which still exist are updated,
+	// test cases deleted after revision are recreated with new id
+	var caseIDs []int
+	exist := make(map[int]bool)
+	for _, testCase := range before.TestCases {
+		exist[testCase.ID] = true
+	}
+	for _, testCase := range target.TestCases {
+		if exist[testCase.ID] {
+			caseIDs = append(caseIDs, testCase.ID)
+		}
+	}
+	deleteDB := tx.Where("problem_id = ?", id)
+	if len(caseIDs) > 0 {
+		deleteDB = deleteDB.Where("id not in (?)", caseIDs)
+	}
+	if err := deleteDB.Delete(&model.ProblemTestCase{}).Error; err != nil {
+		return rollback(err, "delete test cases of problem")
+	}
+	for _, testCase := range target.TestCases {
+		// checksum of inline test data isn't saved
+		if testCase.InputKey == "" {
+			testCase.InputSize, testCase.InputSum = 0, ""
+		}
+		if testCase.OutputKey == "" {
+			testCase.OutputSize, testCase.OutputSum = 0, ""
+		}
+
+		if !exist[testCase.ID] {
+			testCase.ID, testCase.ProblemID = 0, id
+			if err := tx.Create(&testCase).Error; err != nil {
+				return rollback(err, "recreate test case of problem")
+			}
+			continue
+		}
+
+		err = tx.Model(&model.ProblemTestCase{ID: testCase.ID}).Updates(map[string]interface{}{
+			"input_data":      testCase.InputData,
+			"expected_output": testCase.ExpectedOutput,
+			"input_key":       testCase.InputKey,
+			"input_size":      testCase.InputSize,
+			"input_sum":       testCase.InputSum,
+			"output_key":      testCase.OutputKey,
+			"output_size":     testCase.OutputSize,
+			"output_sum":      testCase.OutputSum,
+			"weight":          testCase.Weight,
+		}).Error
+		if err != nil {
+			return rollback(err, "rollback test case of problem")
+		}
+	}
+
+	after, err := takeSnapshot(c, tx, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	commit := arg.CommitMsg
+	if commit == "" {
+		commit = fmt.Sprintf("rollback to revision %d", logID)
+	}
+	if err := recordRevision(c, tx, id, before, after, commit); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit().Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"commit rollback of problem", id) != mysql.Success {
+		return err
+	}
+
+	log.For(ctx).Info("rollback problem success", zap.Int("problemID", id), zap.Int("logID", logID))
+	return nil
+}
+
+// changed fields between two snapshots, sorted by field
+func diffSnapshot(before, after *data.ProblemSnapshot) ([]data.FieldChange, error) {
+	beforeFields, err := flattenSnapshot(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := flattenSnapshot(after)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []string
+	for field := range beforeFields {
+		fields = append(fields, field)
+	}
+	for field := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []data.FieldChange{}
+	for _, field := range fields {
+		if !reflect.DeepEqual(beforeFields[field], afterFields[field]) {
+			changes = append(changes, data.FieldChange{
+				Field:  field,
+				Before: beforeFields[field],
+				After:  afterFields[field],
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+// flatten snapshot to map of field path and value,
+// test cases are identified by id and test data is compared by checksum
+func flattenSnapshot(snapshot *data.ProblemSnapshot) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	if snapshot == nil {
+		return fields, nil
+	}
+
+	content, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(content, &m); err != nil {
+		return nil, err
+	}
+
+	// samples are recreated when rollback, id is meaningless
+	if samples, ok := m["samples"].([]interface{}); ok {
+		for _, sample := range samples {
+			if sample, ok := sample.(map[string]interface{}); ok {
+				delete(sample, "id")
+			}
+		}
+	}
+
+	testCases := make(map[string]interface{})
+	for _, testCase := range snapshot.TestCases {
+		testCases[strconv.Itoa(testCase.ID)] = map[string]interface{}{
+			"input_size":    float64(testCase.InputSize),
+			"input_sha256":  testCase.InputSum,
+			"output_size":   float64(testCase.OutputSize),
+			"output_sha256": testCase.OutputSum,
+			"weight":        float64(testCase.Weight),
+		}
+	}
+	m["test_cases"] = testCases
+
+	flatten("", m, fields)
+	return fields, nil
+}
+
+// slice of objects is flattened by index, slice of values is compared as a whole
+func flatten(prefix string, v interface{}, fields map[string]interface{}) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			flatten(join(k), item, fields)
+		}
+	case []interface{}:
+		if len(val) == 0 {
+			return
+		}
+		if _, ok := val[0].(map[string]interface{}); ok {
+			for i, item := range val {
+				flatten(join(strconv.Itoa(i)), item, fields)
+			}
+			return
+		}
+		fields[prefix] = val
+	default:
+		fields[prefix] = val
+	}
+}
@@ -0,0 +1,71 @@
+package srv
+
+import (
+	"testing"
+
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSnapshot(t *testing.T) {
+	before := &data.ProblemSnapshot{
+		Name:      "a+b",
+		TimeLimit: 1000,
+		Tags:      []string{"math"},
+		Samples:   []model.ProblemSample{{ID: 1, Input: "1 2", Output: "3"}},
+		TestCases: []model.ProblemTestCase{
+			{ID: 1, InputSum: "a", OutputSum: "b", Weight: 1},
+			{ID: 2, InputSum: "c", OutputSum: "d", Weight: 1},
+		},
+	}
+	after := &data.ProblemSnapshot{
+		Name:      "a+b",
+		TimeLimit: 2000,
+		Tags:      []string{"math"},
+		Samples:   []model.ProblemSample{{ID: 5, Input: "1 2", Output: "3"}},
+		TestCases: []model.ProblemTestCase{
+			{ID: 1, InputSum: "a", OutputSum: "e", Weight: 1},
+		},
+	}
+
+	changes, err := diffSnapshot(before, after)
+	assert.NoError(t, err)
+
+	fields := map[string]data.FieldChange{}
+	for _, change := range changes {
+		fields[change.Field] = change
+	}
+	assert.Len(t, changes, 7)
+	assert.Equal(t, float64(1000), fields["time_limit"].Before)
+	assert.Equal(t, float64(2000), fields["time_limit"].After)
+	assert.Equal(t, "e", fields["test_cases.1.output_sha256"].After)
+	assert.Equal(t, "c", fields["test_cases.2.input_sha256"].Before)
+	assert.Nil(t, fields["test_cases.2.input_sha256"].After)
+
+	// problem is created
+	changes, err = diffSnapshot(nil, after)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, changes)
+
+	changes, err = diffSnapshot(after, after)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestRemovedTestDataKeys(t *testing.T) {
+	before := &data.ProblemSnapshot{
+		TestCases: []model.ProblemTestCase{
+			{ID: 1, InputKey: "a", OutputKey: "b"},
+			{ID: 2, InputKey: "c", OutputKey: "d"},
+		},
+	}
+	after := &data.ProblemSnapshot{
+		TestCases: []model.ProblemTestCase{
+			{ID: 1, InputKey: "a", OutputKey: "e"},
+		},
+	}
+
+	assert.Equal(t, []string{"b", "c", "d"}, removedTestDataKeys(before, after))
+	assert.Empty(t, removedTestDataKeys(nil, after))
+}
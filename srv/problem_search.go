@@ -0,0 +1,211 @@
+package srv
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/si9ma/KillOJ-backend/auth"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-common/judge"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/si9ma/KillOJ-common/mysql"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	// problems visible to user, same rule as noOfSql
+	visibleProblemCond = `
+		(
+			problem.belong_type = 0 or
+			problem.owner_id = ? or
+			(problem.belong_type = 1 and exists (
+				select 1 from user_in_group as up where up.user_id = ? and up.group_id = problem.belong_to_id)) or
+			(problem.belong_type = 2 and exists (
+				select 1 from user_in_contest as uc where uc.user_id = ? and uc.contest_id = problem.belong_to_id) and
+				problem.belong_to_id not in (` + contestOfUpcomingSql + `)) or
+			(problem.belong_type = 2 and exists (
+				select 1 from virtual_participation as vp
+				where vp.user_id = ? and vp.contest_id = problem.belong_to_id and vp.start_time <= ?))
+		) and
+		problem.id not in (` + problemOfArchivedSql + `)
+		`
+
+	// accepted rate of problem precomputed in problem_stat, 0 when problem has no submit
+	acRateSql = "ifnull(problem_stat.accepted_count / problem_stat.submit_count, 0)"
+
+	solvedByMeSql = `
+		exists (select 1 from submit as s
+		where s.problem_id = problem.id and s.user_id = ? and s.is_complete = 1 and s.result = ?)
+		`
+
+	// relevance of keywords, by FULLTEXT index of name, description and source
+	keywordMatchSql = "match(problem.name, problem.`desc`, problem.source) against (? in boolean mode)"
+
+	// weight of keyword matched in name, source and description, when FULLTEXT index doesn't exist
+	keywordRelevanceSql = "(problem.name like ?) * 4 + (problem.source like ?) * 2 + (problem.`desc` like ?)"
+
+	problemFulltextIndex = "ft_problem_text"
+
+	maxSearchKeywords = 10
+)
+
+// split keyword by whitespace, too many keywords are ignored
+func splitKeywords(keyword string) []string {
+	keywords := strings.Fields(keyword)
+	if len(keywords) > maxSearchKeywords {
+		keywords = keywords[:maxSearchKeywords]
+	}
+	return keywords
+}
+
+// the FULLTEXT index is created by migration, it's checked once it exists
+var problemFulltext struct {
+	sync.Mutex
+	exist bool
+}
+
+// check if the FULLTEXT index of problem exists, LIKE is used when it doesn't exist
+func hasProblemFulltext(c *gin.Context) bool {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	problemFulltext.Lock()
+	defer problemFulltext.Unlock()
+	if problemFulltext.exist {
+		return true
+	}
+
+	count := 0
+	err := db.Raw("select count(*) from information_schema.statistics "+
+		"where table_schema = database() and table_name = ? and index_name = ?",
+		"problem", problemFulltextIndex).Row().Scan(&count)
+	if err != nil {
+		log.For(ctx).Error("check fulltext index of problem fail", zap.Error(err))
+		return false
+	}
+	if count == 0 {
+		log.For(ctx).Warn("fulltext index of problem not exist, search by like",
+			zap.String("index", problemFulltextIndex))
+	}
+
+	problemFulltext.exist = count > 0
+	return problemFulltext.exist
+}
+
+// every keyword is required and matched as phrase, so that operators of boolean mode are ignored
+func keywordQuery(keywords []string) string {
+	var terms []string
+	for _, keyword := range keywords {
+		keyword = strings.Replace(keyword, `"`, "", -1)
+		if keyword == "" {
+			continue
+		}
+		terms = append(terms, `+"`+keyword+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// escape wildcard of like pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// search problems visible to user,
+// order by relevance when keyword isn't empty
+func SearchProblems(c *gin.Context, spec *data.PageSpec, arg *data.ProblemSearchArg) (*data.PageResult, error) {
+	var problems []model.Problem
+
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	myID := auth.GetUserFromJWT(c).ID
+
+	now := time.Now()
+	queryDB := db.Select("problem.*").Where(visibleProblemCond, myID, myID, myID, now, myID, now)
+
+	// every keyword should match name, description or source
+	var relevance interface{}
+	keywords := splitKeywords(arg.Keyword)
+	if len(keywords) > 0 && hasProblemFulltext(c) {
+		if query := keywordQuery(keywords); query != "" {
+			queryDB = queryDB.Where(keywordMatchSql, query)
+			relevance = gorm.Expr(keywordMatchSql+" desc", query)
+		}
+	} else if len(keywords) > 0 {
+		var sums []string
+		var args []interface{}
+		for _, keyword := range keywords {
+			pattern := "%" + escapeLike(keyword) + "%"
+			queryDB = queryDB.Where("(problem.name like ? or problem.`desc` like ? or problem.source like ?)",
+				pattern, pattern, pattern)
+			sums = append(sums, keywordRelevanceSql)
+			args = append(args, pattern, pattern, pattern)
+		}
+		relevance = gorm.Expr("("+strings.Join(sums, " + ")+") desc", args...)
+	}
+
+	if len(arg.Difficulties) > 0 {
+		queryDB = queryDB.Where("problem.difficulty in (?)", arg.Difficulties)
+	}
+
+	if arg.CatalogID != 0 {
+		queryDB = queryDB.Where("problem.catalog_id = ?", arg.CatalogID)
+	}
+
+	if len(arg.Tags) > 0 {
+		if arg.TagMode == data.TagModeAnd {
+			queryDB = queryDB.Where("problem.id in (select problem_id from problem_has_tag where tag_id in (?) "+
+				"group by problem_id having count(distinct tag_id) = ?)", arg.Tags, len(arg.Tags))
+		} else {
+			queryDB = queryDB.Where("problem.id in (select problem_id from problem_has_tag where tag_id in (?))", arg.Tags)
+		}
+	}
+
+	switch arg.Solved {
+	case data.SolvedByMe:
+		queryDB = queryDB.Where(solvedByMeSql, myID, judge.AcceptedStatus.Code)
+	case data.UnsolvedByMe:
+		queryDB = queryDB.Where("not "+solvedByMeSql, myID, judge.AcceptedStatus.Code)
+	}
+
+	if arg.MinAcRate != nil || arg.MaxAcRate != nil {
+		queryDB = queryDB.Joins("left join problem_stat on problem_stat.problem_id = problem.id")
+	}
+	if arg.MinAcRate != nil {
+		queryDB = queryDB.Where(acRateSql+" >= ?", *arg.MinAcRate)
+	}
+	if arg.MaxAcRate != nil {
+		queryDB = queryDB.Where(acRateSql+" <= ?", *arg.MaxAcRate)
+	}
+
+	total, err := CountRows(c, queryDB.Model(&model.Problem{}), "count searched problems")
+	if err != nil {
+		return nil, err
+	}
+
+	if relevance != nil {
+		queryDB = queryDB.Order(relevance)
+	}
+	queryDB = queryDB.Order("problem.id")
+
+	err = queryDB.Preload("Tags").Preload("UpVoteUsers", "attitude = ?", model.Up).
+		Preload("DownVoteUsers", "attitude = ?", model.Down).Preload("Catalog").
+		Limit(spec.Limit).Offset(spec.Offset).Find(&problems).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"search problems", arg.Keyword) != mysql.Success {
+		return nil, err
+	}
+
+	wraps, err := wrapProblems(c, problems)
+	if err != nil {
+		return nil, err
+	}
+
+	log.For(ctx).Info("success search problems", zap.String("keyword", arg.Keyword))
+	return NewPageResult(spec, total, wraps), nil
+}
@@ -0,0 +1,26 @@
+package srv
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitKeywords(t *testing.T) {
+	assert.Equal(t, []string{"a+b", "problem"}, splitKeywords("  a+b\tproblem \n"))
+	assert.Empty(t, splitKeywords(" "))
+	assert.Len(t, splitKeywords(strings.Repeat("x ", 20)), maxSearchKeywords)
+}
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, `100\%`, escapeLike("100%"))
+	assert.Equal(t, `a\_b`, escapeLike("a_b"))
+	assert.Equal(t, `c:\\`, escapeLike(`c:\`))
+}
+
+func TestKeywordQuery(t *testing.T) {
+	assert.Equal(t, `+"a+b" +"problem"`, keywordQuery([]string{"a+b", "problem"}))
+	assert.Equal(t, `+"x"`, keywordQuery([]string{`"x"`, `""`}))
+	assert.Empty(t, keywordQuery(nil))
+}
@@ -0,0 +1,238 @@
+package srv
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/si9ma/KillOJ-backend/auth"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-common/judge"
+	"github.com/si9ma/KillOJ-common/kjson"
+	"github.com/si9ma/KillOJ-common/kredis"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/si9ma/KillOJ-common/mysql"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	ProblemStatsPrefix = "killoj_problem_stats_"
+
+	// stats is refreshed after timeout, new submits are not counted before that
+	problemStatsTimeout = time.Minute
+)
+
+// wrap problems with status of current user and global stats
+func wrapProblems(c *gin.Context, problems []model.Problem) ([]data.ProblemWrap, error) {
+	var ids []int
+	for _, problem := range problems {
+		ids = append(ids, problem.ID)
+	}
+
+	stats, err := getProblemStats(c, ids)
+	if err != nil {
+		return nil, err
+	}
+	status, err := getMyProblemStatus(c, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	wraps := make([]data.ProblemWrap, len(problems))
+	for i, problem := range problems {
+		wraps[i] = data.ProblemWrap{
+			Problem:  problem,
+			MyStatus: status[problem.ID],
+			Stats:    stats[problem.ID],
+		}
+	}
+
+	return wraps, nil
+}
+
+type problemStatusRow struct {
+	ProblemID int `gorm:"column:problem_id"`
+	Accepted  int `gorm:"column:accepted"`
+}
+
+// status of problems for current user,
+// problem is attempted when user has any submit but no accepted submit
+func getMyProblemStatus(c *gin.Context, ids []int) (map[int]string, error) {
+	var rows []problemStatusRow
+
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	myID := auth.GetUserFromJWT(c).ID
+
+	if len(ids) == 0 {
+		return newProblemStatus(ids, nil), nil
+	}
+
+	// result of incomplete submit is meaningless
+	err := db.Table("submit").
+		Select("problem_id, max(is_complete = 1 and result = ?) as accepted", judge.AcceptedStatus.Code).
+		Where("user_id = ? AND problem_id in (?)", myID, ids).Group("problem_id").Scan(&rows).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get status of problems for user", myID) != mysql.Success {
+		return nil, err
+	}
+
+	return newProblemStatus(ids, rows), nil
+}
+
+// problem without submit of user is untouched
+func newProblemStatus(ids []int, rows []problemStatusRow) map[int]string {
+	status := make(map[int]string)
+	for _, id := range ids {
+		status[id] = data.ProblemUntouched
+	}
+	for _, row := range rows {
+		if row.Accepted > 0 {
+			status[row.ProblemID] = data.ProblemAccepted
+		} else {
+			status[row.ProblemID] = data.ProblemAttempted
+		}
+	}
+	return status
+}
+
+// global stats of problems, read from cache first
+func getProblemStats(c *gin.Context, ids []int) (map[int]data.ProblemStats, error) {
+	ctx := c.Request.Context()
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+
+	stats := make(map[int]data.ProblemStats)
+	if len(ids) == 0 {
+		return stats, nil
+	}
+
+	// get from cache
+	pipe := redisCli.Pipeline()
+	cmds := make([]*redis.StringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.Get(ProblemStatsPrefix + strconv.Itoa(id))
+	}
+	// missed stats are calculated when fail to get from cache
+	if _, err := pipe.Exec(); err != nil && err != redis.Nil {
+		log.For(ctx).Error("get stats of problems from cache fail", zap.Error(err), zap.Ints("problemIDs", ids))
+	}
+
+	var missIDs []int
+	for i, cmd := range cmds {
+		item := data.ProblemStats{}
+		val, err := cmd.Result()
+		if err != nil {
+			missIDs = append(missIDs, ids[i])
+			continue
+		}
+		if err := kjson.UnmarshalString(val, &item); err != nil {
+			log.For(ctx).Error("unmarshal stats of problem fail", zap.Error(err), zap.Int("problemID", ids[i]))
+			missIDs = append(missIDs, ids[i])
+			continue
+		}
+		stats[ids[i]] = item
+	}
+
+	if len(missIDs) == 0 {
+		return stats, nil
+	}
+
+	missStats, err := calcProblemStats(c, missIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// save to cache in best effort, fail to cache don't fail the request
+	pipe = redisCli.Pipeline()
+	for id, item := range missStats {
+		stats[id] = item
+		val, err := kjson.MarshalString(item)
+		if err != nil {
+			log.For(ctx).Error("marshal stats of problem fail", zap.Error(err), zap.Int("problemID", id))
+			continue
+		}
+		pipe.Set(ProblemStatsPrefix+strconv.Itoa(id), val, problemStatsTimeout)
+	}
+	if _, err := pipe.Exec(); err != nil {
+		log.For(ctx).Error("save stats of problems to cache fail", zap.Error(err), zap.Ints("problemIDs", missIDs))
+	}
+
+	return stats, nil
+}
+
+// calculate stats of problems from complete submits
+func calcProblemStats(c *gin.Context, ids []int) (map[int]data.ProblemStats, error) {
+	var rows []struct {
+		ProblemID     int `gorm:"column:problem_id"`
+		SubmitCount   int `gorm:"column:submit_count"`
+		AcceptedCount int `gorm:"column:accepted_count"`
+	}
+
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	err := db.Table("submit").
+		Select("problem_id, count(*) as submit_count, sum(result = ?) as accepted_count", judge.AcceptedStatus.Code).
+		Where("is_complete = ? AND problem_id in (?)", true, ids).Group("problem_id").Scan(&rows).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"calculate stats of problems", ids) != mysql.Success {
+		return nil, err
+	}
+
+	stats := make(map[int]data.ProblemStats)
+	for _, id := range ids {
+		stats[id] = data.ProblemStats{}
+	}
+	for _, row := range rows {
+		stats[row.ProblemID] = newProblemStats(row.SubmitCount, row.AcceptedCount)
+	}
+
+	return stats, nil
+}
+
+func newProblemStats(submitCount, acceptedCount int) data.ProblemStats {
+	stats := data.ProblemStats{
+		SubmitCount:   submitCount,
+		AcceptedCount: acceptedCount,
+	}
+	if submitCount > 0 {
+		stats.AcceptedRatio = float64(acceptedCount) / float64(submitCount)
+	}
+	return stats
+}
+
+// precomputed stat of problem is calculated from complete submits of the problem
+// instead of increased, so that it's the same when the submit is collected again after fail
+func refreshProblemStat(ctx context.Context, problemID int) error {
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	return db.Exec("replace into problem_stat (problem_id, submit_count, accepted_count) "+
+		"select ?, count(*), ifnull(sum(result = ?), 0) from submit where problem_id = ? and is_complete = ?",
+		problemID, judge.AcceptedStatus.Code, problemID, true).Error
+}
+
+// rebuild precomputed stats of problems from complete submits
+func rebuildProblemStats(ctx context.Context) error {
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	tx := db.Begin()
+	if err := tx.Exec("delete from problem_stat").Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	err := tx.Exec("insert into problem_stat (problem_id, submit_count, accepted_count) "+
+		"select problem_id, count(*), sum(result = ?) from submit "+
+		"where is_complete = ? group by problem_id",
+		judge.AcceptedStatus.Code, true).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
@@ -0,0 +1,28 @@
+package srv
+
+import (
+	"testing"
+
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewProblemStatus(t *testing.T) {
+	status := newProblemStatus([]int{1, 2, 3}, []problemStatusRow{
+		{ProblemID: 1, Accepted: 1},
+		{ProblemID: 2, Accepted: 0},
+	})
+	assert.Equal(t, map[int]string{
+		1: data.ProblemAccepted,
+		2: data.ProblemAttempted,
+		3: data.ProblemUntouched,
+	}, status)
+	assert.Empty(t, newProblemStatus(nil, nil))
+}
+
+func TestNewProblemStats(t *testing.T) {
+	assert.Equal(t, data.ProblemStats{SubmitCount: 4, AcceptedCount: 1, AcceptedRatio: 0.25}, newProblemStats(4, 1))
+
+	// no submit
+	assert.Equal(t, data.ProblemStats{}, newProblemStats(0, 0))
+}
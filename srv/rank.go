@@ -0,0 +1,450 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/si9ma/KillOJ-backend/auth"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/kerror"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/judge"
+	"github.com/si9ma/KillOJ-common/kredis"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/si9ma/KillOJ-common/mysql"
+	"github.com/si9ma/KillOJ-common/tip"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	RankPrefix   = "killoj_rank_"      // sorted set of users in a period, member is user id
+	RankBuiltKey = "killoj_rank_built" // rank is built from submits
+	rankLockKey  = "killoj_rank_lock"
+
+	rankLockTimeout = 5 * time.Minute
+
+	// score of user is solved * rankSolvedWeight - submit count,
+	// so that users are ordered by solved desc, then submit count asc
+	rankSolvedWeight = 1000000000
+)
+
+var rankPeriods = []string{data.RankPeriodAll, data.RankPeriodWeek, data.RankPeriodMonth}
+
+// key and expiration of rank for period which t belongs to,
+// rank of week and month is kept for a period after last update
+func rankBucket(period string, t time.Time) (string, time.Duration) {
+	switch period {
+	case data.RankPeriodWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("week_%d_%02d", year, week), 2 * 7 * 24 * time.Hour
+	case data.RankPeriodMonth:
+		return t.Format("month_2006_01"), 2 * 31 * 24 * time.Hour
+	default:
+		return data.RankPeriodAll, 0
+	}
+}
+
+// start time of period which t belongs to, week starts at monday
+func rankPeriodStart(period string, t time.Time) time.Time {
+	year, month, day := t.Date()
+	switch period {
+	case data.RankPeriodWeek:
+		weekday := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-weekday, 0, 0, 0, 0, t.Location())
+	case data.RankPeriodMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Time{}
+	}
+}
+
+// start time of next period, zero for all time
+func rankPeriodEnd(period string, start time.Time) time.Time {
+	switch period {
+	case data.RankPeriodWeek:
+		return start.AddDate(0, 0, 7)
+	case data.RankPeriodMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return time.Time{}
+	}
+}
+
+func encodeRankScore(solved, submits int) float64 {
+	return float64(solved*rankSolvedWeight - submits)
+}
+
+func decodeRankScore(score float64) (solved, submits int) {
+	solved = int(math.Ceil(score / rankSolvedWeight))
+	submits = solved*rankSolvedWeight - int(score)
+	return solved, submits
+}
+
+// only one instance can update rank at the same time
+func lockRank(redisCli *redis.ClusterClient) (bool, error) {
+	return redisCli.SetNX(rankLockKey, 1, rankLockTimeout).Result()
+}
+
+func unlockRank(redisCli *redis.ClusterClient) {
+	if err := redisCli.Del(rankLockKey).Err(); err != nil {
+		log.Bg().Error("unlock rank fail", zap.Error(err))
+	}
+}
+
+// score of user in the period which t belongs to is calculated from complete submits
+// instead of increased, so that it's the same when the submit is collected again after fail
+func refreshUserRank(ctx context.Context, redisCli *redis.ClusterClient, userID int, period string, t time.Time) error {
+	var solved []int
+
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	key, expiration := rankBucket(period, t)
+
+	submitDB := db.Model(&model.Submit{}).Where("user_id = ? AND is_complete = ?", userID, true)
+	if start := rankPeriodStart(period, t); !start.IsZero() {
+		submitDB = submitDB.Where("created_at >= ? AND created_at < ?", start, rankPeriodEnd(period, start))
+	}
+
+	count := 0
+	if err := submitDB.Count(&count).Error; err != nil {
+		return err
+	}
+	err := submitDB.Where("result = ?", judge.AcceptedStatus.Code).Pluck("distinct problem_id", &solved).Error
+	if err != nil {
+		return err
+	}
+
+	pipe := redisCli.Pipeline()
+	pipe.ZAdd(RankPrefix+key, redis.Z{
+		Score:  encodeRankScore(len(solved), count),
+		Member: strconv.Itoa(userID),
+	})
+	if expiration > 0 {
+		pipe.Expire(RankPrefix+key, expiration)
+	}
+	_, err = pipe.Exec()
+	return err
+}
+
+// update rank of every period which the submit belongs to,
+// only rank of current periods is updated for rejudged submit
+func updateRank4Submit(ctx context.Context, redisCli *redis.ClusterClient, submit *model.Submit, rejudge bool) error {
+	now := time.Now()
+
+	for _, period := range rankPeriods {
+		key, _ := rankBucket(period, submit.CreatedAt)
+		if current, _ := rankBucket(period, now); rejudge && key != current {
+			continue
+		}
+		if err := refreshUserRank(ctx, redisCli, submit.UserID, period, submit.CreatedAt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rebuild rank of current periods from complete submits,
+// the caller should hold the lock
+func rebuildRank(ctx context.Context) error {
+	type rankRow struct {
+		UserID      int `gorm:"column:user_id"`
+		ProblemID   int `gorm:"column:problem_id"`
+		Accepted    int `gorm:"column:accepted"`
+		SubmitCount int `gorm:"column:submit_count"`
+	}
+
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+	now := time.Now()
+
+	// precomputed stats of problems are updated by collector too
+	if err := rebuildProblemStats(ctx); err != nil {
+		return err
+	}
+
+	for _, period := range rankPeriods {
+		var rows []rankRow
+		key, expiration := rankBucket(period, now)
+
+		submitDB := db.Table("submit").Where("is_complete = ?", true)
+		if start := rankPeriodStart(period, now); !start.IsZero() {
+			submitDB = submitDB.Where("created_at >= ?", start)
+		}
+		err := submitDB.Select("user_id, problem_id, max(result = ?) as accepted, count(*) as submit_count",
+			judge.AcceptedStatus.Code).Group("user_id, problem_id").Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+
+		solved := make(map[int]int)
+		submits := make(map[int]int)
+		for _, row := range rows {
+			submits[row.UserID] += row.SubmitCount
+			if row.Accepted > 0 {
+				solved[row.UserID]++
+			}
+		}
+
+		pipe := redisCli.Pipeline()
+		pipe.Del(RankPrefix + key)
+		for userID, count := range submits {
+			pipe.ZAdd(RankPrefix+key, redis.Z{
+				Score:  encodeRankScore(solved[userID], count),
+				Member: strconv.Itoa(userID),
+			})
+		}
+		if expiration > 0 {
+			pipe.Expire(RankPrefix+key, expiration)
+		}
+		if _, err := pipe.Exec(); err != nil {
+			return err
+		}
+	}
+
+	if err := redisCli.Set(RankBuiltKey, 1, 0).Err(); err != nil {
+		return err
+	}
+
+	log.For(ctx).Info("success rebuild rank")
+	return nil
+}
+
+// rebuild rank from submits, e.g. when rank in redis is lost
+func RebuildRank(c *gin.Context) error {
+	ctx := c.Request.Context()
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+
+	ok, err := lockRank(redisCli)
+	if kredis.ErrorHandleAndLog(c, err, true, "lock rank", rankLockKey, nil) != kredis.Success {
+		return err
+	}
+	if !ok {
+		log.For(ctx).Error("rank is updating")
+		_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrHaveRunningTask)
+		return kerror.EmptyError
+	}
+	defer unlockRank(redisCli)
+
+	if err := rebuildRank(ctx); err != nil {
+		log.For(ctx).Error("rebuild rank fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return err
+	}
+
+	return nil
+}
+
+// global rank only includes users who have complete submits in the period,
+// rank of group and organization includes all members
+func GetRank(c *gin.Context, arg *data.RankArg) (*data.RankList, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	if arg.Period == "" {
+		arg.Period = data.RankPeriodAll
+	}
+	key, _ := rankBucket(arg.Period, time.Now())
+	key = RankPrefix + key
+
+	var users []data.RankUser
+	userDB := db.Table("user").Select("user.id, user.name, user.organization, user.avatar_url")
+	switch arg.Of {
+	case data.RankOfGroup:
+		if arg.ID == 0 {
+			log.For(ctx).Error("id of group shouldn't empty")
+			fields := map[string]string{
+				"id": tip.MustNotEmptyTip.String(),
+			}
+			_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).SetMeta(kerror.ErrArgValidateFail.With(fields))
+			return nil, kerror.EmptyError
+		}
+
+		// only member of group can see rank of group
+		if _, err := GetGroup(c, arg.ID); err != nil {
+			return nil, err
+		}
+
+		err := userDB.Joins("join user_in_group on user_in_group.user_id = user.id").
+			Where("user_in_group.group_id = ?", arg.ID).Scan(&users).Error
+		if mysql.ErrorHandleAndLog(c, err, true,
+			"get members of group", arg.ID) != mysql.Success {
+			return nil, err
+		}
+	case data.RankOfOrganization:
+		if arg.Name == "" {
+			me := model.User{}
+			err := db.Select("organization").First(&me, auth.GetUserFromJWT(c).ID).Error
+			if mysql.ErrorHandleAndLog(c, err, true,
+				"get organization of user", auth.GetUserFromJWT(c).ID) != mysql.Success {
+				return nil, err
+			}
+			arg.Name = me.Organization
+		}
+		if arg.Name == "" {
+			log.For(ctx).Error("name of organization shouldn't empty")
+			fields := map[string]string{
+				"name": tip.MustNotEmptyTip.String(),
+			}
+			_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).SetMeta(kerror.ErrArgValidateFail.With(fields))
+			return nil, kerror.EmptyError
+		}
+
+		err := userDB.Where("user.organization = ?", arg.Name).Scan(&users).Error
+		if mysql.ErrorHandleAndLog(c, err, true,
+			"get members of organization", arg.Name) != mysql.Success {
+			return nil, err
+		}
+	default:
+		return getGlobalRank(c, key, arg)
+	}
+
+	items, err := getMemberRank(c, key, users)
+	if err != nil {
+		return nil, err
+	}
+
+	list := data.RankList{
+		Period: arg.Period,
+		Total:  len(items),
+		Rows:   []data.RankItem{},
+	}
+	offset := (arg.Page - 1) * arg.PageSize
+	if offset < len(items) {
+		end := offset + arg.PageSize
+		if end > len(items) {
+			end = len(items)
+		}
+		list.Rows = items[offset:end]
+	}
+
+	log.For(ctx).Info("success get rank", zap.String("of", arg.Of), zap.String("period", arg.Period))
+	return &list, nil
+}
+
+// page of global rank, rank of user is the count of users with higher score plus 1
+func getGlobalRank(c *gin.Context, key string, arg *data.RankArg) (*data.RankList, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+	offset := (arg.Page - 1) * arg.PageSize
+
+	total, err := redisCli.ZCard(key).Result()
+	if kredis.ErrorHandleAndLog(c, err, true, "get count of rank", key, nil) != kredis.Success {
+		return nil, err
+	}
+	members, err := redisCli.ZRevRangeWithScores(key, int64(offset), int64(offset+arg.PageSize-1)).Result()
+	if kredis.ErrorHandleAndLog(c, err, true, "get rank", key, nil) != kredis.Success {
+		return nil, err
+	}
+
+	list := data.RankList{
+		Period: arg.Period,
+		Total:  int(total),
+		Rows:   []data.RankItem{},
+	}
+	if len(members) == 0 {
+		return &list, nil
+	}
+
+	pipe := redisCli.Pipeline()
+	higher := make(map[float64]*redis.IntCmd)
+	var ids []int
+	for _, member := range members {
+		if _, ok := higher[member.Score]; !ok {
+			higher[member.Score] = pipe.ZCount(key, "("+strconv.FormatFloat(member.Score, 'f', -1, 64), "+inf")
+		}
+		id, _ := strconv.Atoi(member.Member.(string))
+		ids = append(ids, id)
+	}
+	_, err = pipe.Exec()
+	if kredis.ErrorHandleAndLog(c, err, true, "get rank of users", key, ids) != kredis.Success {
+		return nil, err
+	}
+
+	var users []data.RankUser
+	err = db.Table("user").Select("id, name, organization, avatar_url").
+		Where("id in (?)", ids).Scan(&users).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get users of rank", ids) != mysql.Success {
+		return nil, err
+	}
+	userOf := make(map[int]data.RankUser)
+	for _, user := range users {
+		userOf[user.ID] = user
+	}
+
+	for i, member := range members {
+		solved, submits := decodeRankScore(member.Score)
+		list.Rows = append(list.Rows, data.RankItem{
+			Rank:        int(higher[member.Score].Val()) + 1,
+			User:        userOf[ids[i]],
+			SolvedCount: solved,
+			SubmitCount: submits,
+		})
+	}
+
+	log.For(ctx).Info("success get global rank", zap.String("period", arg.Period))
+	return &list, nil
+}
+
+// rank of users, users without submit are at the end
+func getMemberRank(c *gin.Context, key string, users []data.RankUser) ([]data.RankItem, error) {
+	ctx := c.Request.Context()
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+
+	scores := make(map[int]float64)
+	if len(users) > 0 {
+		pipe := redisCli.Pipeline()
+		cmds := make([]*redis.FloatCmd, len(users))
+		for i, user := range users {
+			cmds[i] = pipe.ZScore(key, strconv.Itoa(user.ID))
+		}
+		_, err := pipe.Exec()
+		if res := kredis.ErrorHandleAndLog(c, err, false,
+			"get score of users", key, nil); res == kredis.DB_ERROR {
+			return nil, err
+		}
+		for i, cmd := range cmds {
+			scores[users[i].ID] = cmd.Val()
+		}
+	}
+
+	return sortRank(users, scores), nil
+}
+
+// sort users by score desc, then id asc, users with same score have same rank
+func sortRank(users []data.RankUser, scores map[int]float64) []data.RankItem {
+	sort.SliceStable(users, func(i, j int) bool {
+		si, sj := scores[users[i].ID], scores[users[j].ID]
+		if si != sj {
+			return si > sj
+		}
+		return users[i].ID < users[j].ID
+	})
+
+	items := []data.RankItem{}
+	for i, user := range users {
+		solved, submits := decodeRankScore(scores[user.ID])
+		item := data.RankItem{
+			Rank:        i + 1,
+			User:        user,
+			SolvedCount: solved,
+			SubmitCount: submits,
+		}
+		if i > 0 && scores[user.ID] == scores[users[i-1].ID] {
+			item.Rank = items[i-1].Rank
+		}
+		items = append(items, item)
+	}
+
+	return items
+}
@@ -0,0 +1,76 @@
+package srv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRankScore(t *testing.T) {
+	tests := []struct {
+		solved  int
+		submits int
+	}{
+		{0, 0},
+		{0, 7},
+		{1, 1},
+		{3, 0},
+		{12, 345},
+	}
+
+	for _, test := range tests {
+		solved, submits := decodeRankScore(encodeRankScore(test.solved, test.submits))
+		assert.Equal(t, test.solved, solved)
+		assert.Equal(t, test.submits, submits)
+	}
+
+	// more solved is better, then less submits is better
+	assert.True(t, encodeRankScore(2, 100) > encodeRankScore(1, 1))
+	assert.True(t, encodeRankScore(2, 3) > encodeRankScore(2, 4))
+}
+
+func TestRankBucket(t *testing.T) {
+	// 2019-03-03 is sunday
+	now := time.Date(2019, 3, 3, 23, 0, 0, 0, time.Local)
+
+	key, _ := rankBucket(data.RankPeriodWeek, now)
+	assert.Equal(t, "week_2019_09", key)
+	assert.Equal(t, time.Date(2019, 2, 25, 0, 0, 0, 0, time.Local), rankPeriodStart(data.RankPeriodWeek, now))
+
+	key, _ = rankBucket(data.RankPeriodMonth, now)
+	assert.Equal(t, "month_2019_03", key)
+	assert.Equal(t, time.Date(2019, 3, 1, 0, 0, 0, 0, time.Local), rankPeriodStart(data.RankPeriodMonth, now))
+
+	key, expiration := rankBucket(data.RankPeriodAll, now)
+	assert.Equal(t, data.RankPeriodAll, key)
+	assert.Equal(t, time.Duration(0), expiration)
+	assert.True(t, rankPeriodStart(data.RankPeriodAll, now).IsZero())
+
+	assert.Equal(t, time.Date(2019, 3, 4, 0, 0, 0, 0, time.Local),
+		rankPeriodEnd(data.RankPeriodWeek, rankPeriodStart(data.RankPeriodWeek, now)))
+	assert.Equal(t, time.Date(2019, 4, 1, 0, 0, 0, 0, time.Local),
+		rankPeriodEnd(data.RankPeriodMonth, rankPeriodStart(data.RankPeriodMonth, now)))
+	assert.True(t, rankPeriodEnd(data.RankPeriodAll, time.Time{}).IsZero())
+}
+
+func TestSortRank(t *testing.T) {
+	users := []data.RankUser{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}}
+	scores := map[int]float64{
+		1: encodeRankScore(1, 5),
+		2: encodeRankScore(2, 9),
+		4: encodeRankScore(1, 5),
+	}
+
+	items := sortRank(users, scores)
+	var ids, ranks []int
+	for _, item := range items {
+		ids = append(ids, item.User.ID)
+		ranks = append(ranks, item.Rank)
+	}
+	assert.Equal(t, []int{2, 1, 4, 3}, ids)
+	assert.Equal(t, []int{1, 2, 2, 4}, ranks)
+	assert.Equal(t, 0, items[3].SolvedCount)
+	assert.Equal(t, 9, items[0].SubmitCount)
+}
@@ -0,0 +1,553 @@
+package srv
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+	"github.com/si9ma/KillOJ-backend/auth"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/kerror"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/si9ma/KillOJ-common/mysql"
+	"github.com/si9ma/KillOJ-common/tip"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+// participants of contest register in team when max team size greater than 1
+func isTeamContest(contest *model.Contest) bool {
+	return contest.MaxTeamSize > 1
+}
+
+// registration is open for public and approval contest before deadline,
+// deadline is end time of contest when not set
+func isRegistrationOpen(contest *model.Contest, t time.Time) bool {
+	if contest.RegisterMode != model.RegisterByPublic && contest.RegisterMode != model.RegisterByApproval {
+		return false
+	}
+
+	deadline := contest.EndTime
+	if contest.RegisterDeadline != nil && contest.RegisterDeadline.Before(deadline) {
+		deadline = *contest.RegisterDeadline
+	}
+	return !t.After(deadline)
+}
+
+// contest for registration, user needn't be participant of contest
+func getContest4Register(c *gin.Context, id int) (*model.Contest, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	contest := model.Contest{}
+	err := db.Preload("Owner").First(&contest, id).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get contest", id) != mysql.Success {
+		return nil, err
+	}
+
+	if !isRegistrationOpen(&contest, time.Now()) {
+		log.For(ctx).Error("registration of contest is closed", zap.Int("contestId", id))
+		_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrRegistrationClosed)
+		return nil, kerror.EmptyError
+	}
+
+	contest.Phase = contestPhase(&contest, time.Now())
+	return &contest, nil
+}
+
+// lock contest in transaction, so that registrations of contest are serialized,
+// and counts checked in transaction are still valid when commit, contest is reloaded
+func lockContest(tx *gorm.DB, contest *model.Contest) error {
+	return tx.Set("gorm:query_option", "FOR UPDATE").First(contest, contest.ID).Error
+}
+
+// user can't register again when already participant of contest, member of team
+// which isn't rejected, or have registration under review
+func checkNotRegistered(c *gin.Context, db *gorm.DB, contestID, userID int) error {
+	ctx := c.Request.Context()
+
+	checks := []struct {
+		desc  string
+		query *gorm.DB
+	}{
+		{
+			desc: "participant",
+			query: db.Model(&model.UserInContest{}).
+				Where("contest_id = ? AND user_id = ?", contestID, userID),
+		},
+		{
+			desc: "registration",
+			query: db.Model(&model.ContestRegistration{}).
+				Where("contest_id = ? AND user_id = ? AND status = ?", contestID, userID, model.RegistrationPending),
+		},
+		{
+			desc: "team member",
+			query: db.Table("team_member").Joins("join team on team.id = team_member.team_id").
+				Joins("join contest_registration on contest_registration.team_id = team.id").
+				Where("team.contest_id = ? AND team_member.user_id = ? AND contest_registration.status <> ?",
+					contestID, userID, model.RegistrationRejected),
+		},
+	}
+
+	for _, check := range checks {
+		count := 0
+		err := check.query.Count(&count).Error
+		if mysql.ErrorHandleAndLog(c, err, true,
+			"check if "+check.desc+" exist", contestID) != mysql.Success {
+			return err
+		}
+
+		if count > 0 {
+			log.For(ctx).Error("already registered", zap.Int("contestId", contestID),
+				zap.Int("userId", userID), zap.String("as", check.desc))
+			_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
+				SetMeta(kerror.ErrAlreadyExist.WithArgs(check.desc))
+			return kerror.EmptyError
+		}
+	}
+
+	return nil
+}
+
+// team is counted as one participant, owner of contest isn't participant
+func countParticipants(c *gin.Context, db *gorm.DB, contest *model.Contest) (int, error) {
+	var users, teams int
+
+	err := db.Model(&model.UserInContest{}).
+		Where("contest_id = ? AND user_id <> ?", contest.ID, contest.OwnerID).
+		Where("user_id not in (?)", db.Table("team_member").Select("team_member.user_id").
+			Joins("join contest_registration on contest_registration.team_id = team_member.team_id").
+			Where("contest_registration.contest_id = ? AND contest_registration.status = ?",
+				contest.ID, model.RegistrationApproved).SubQuery()).
+		Count(&users).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"count individual participants", contest.ID) != mysql.Success {
+		return 0, err
+	}
+
+	err = db.Model(&model.ContestRegistration{}).
+		Where("contest_id = ? AND team_id <> 0 AND status = ?", contest.ID, model.RegistrationApproved).
+		Count(&teams).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"count team participants", contest.ID) != mysql.Success {
+		return 0, err
+	}
+
+	return users + teams, nil
+}
+
+func checkContestFull(c *gin.Context, db *gorm.DB, contest *model.Contest) error {
+	ctx := c.Request.Context()
+
+	if contest.MaxParticipants == 0 {
+		return nil
+	}
+
+	count, err := countParticipants(c, db, contest)
+	if err != nil {
+		return err
+	}
+
+	if count >= contest.MaxParticipants {
+		log.For(ctx).Error("contest is full", zap.Int("contestId", contest.ID), zap.Int("count", count))
+		_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrContestFull.WithArgs(contest.MaxParticipants))
+		return kerror.EmptyError
+	}
+
+	return nil
+}
+
+// add users to contest, users already in contest are skipped
+func addUsers2Contest(tx *gorm.DB, contestID int, userIDs []int) error {
+	var existIDs []int
+	err := tx.Model(&model.UserInContest{}).Where("contest_id = ? AND user_id in (?)", contestID, userIDs).
+		Pluck("user_id", &existIDs).Error
+	if err != nil {
+		return err
+	}
+
+	exist := make(map[int]bool)
+	for _, id := range existIDs {
+		exist[id] = true
+	}
+
+	for _, id := range userIDs {
+		if exist[id] {
+			continue
+		}
+		if err := tx.Create(&model.UserInContest{ContestID: contestID, UserID: id}).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getRegistration(c *gin.Context, id int) (*model.ContestRegistration, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	registration := model.ContestRegistration{}
+	err := db.Preload("User").Preload("Team").Preload("Team.Members").First(&registration, id).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get registration", id) != mysql.Success {
+		return nil, err
+	}
+
+	return &registration, nil
+}
+
+// list contests open for registration
+func GetOpenContests(c *gin.Context, spec *data.PageSpec) (*data.PageResult, error) {
+	var contests []model.Contest
+
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	if err := CheckSort(c, spec.Sorts, contestSortFields); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	queryDB := db.Model(&model.Contest{}).
+		Where("contest.register_mode in (?)", []model.RegisterMode{model.RegisterByPublic, model.RegisterByApproval}).
+		Where("contest.end_time >= ?", now).
+		Where("contest.register_deadline is null OR contest.register_deadline >= ?", now)
+
+	total := 0
+	err := queryDB.Count(&total).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"count open contests", nil) != mysql.Success {
+		return nil, err
+	}
+
+	err = OrderBy(queryDB, spec.Sorts, contestSortFields).Preload("Owner").
+		Offset(spec.Offset).Limit(spec.Limit).Find(&contests).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get open contests", nil) != mysql.Success {
+		return nil, err
+	}
+
+	for i := range contests {
+		contests[i].Phase = contestPhase(&contests[i], now)
+	}
+
+	log.For(ctx).Info("success get open contests")
+	return NewPageResult(spec, total, contests), nil
+}
+
+// register contest individually or as leader of new team,
+// registration of public contest is approved immediately
+func RegisterContest(c *gin.Context, contestID int, arg *data.RegisterArg) (*model.ContestRegistration, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	myID := auth.GetUserFromJWT(c).ID
+
+	contest, err := getContest4Register(c, contestID)
+	if err != nil {
+		return nil, err
+	}
+
+	// team name is required in team contest
+	if isTeamContest(contest) && arg.TeamName == "" {
+		err := fmt.Errorf("team name is required")
+		log.For(ctx).Error("register contest fail", zap.Error(err))
+		fields := map[string]string{
+			"team_name": fmt.Sprintf(tip.ValidateRequireTip.String(), "team_name"),
+		}
+		_ = c.Error(err).SetType(gin.ErrorTypePublic).SetMeta(kerror.ErrArgValidateFail.With(fields))
+		return nil, err
+	}
+
+	registration := model.ContestRegistration{
+		ContestID: contestID,
+		UserID:    myID,
+		Status:    model.RegistrationPending,
+	}
+	if contest.RegisterMode == model.RegisterByPublic {
+		registration.Status = model.RegistrationApproved
+	}
+
+	tx := db.Begin()
+	rollback := func(err error, desc string) error {
+		mysql.ErrorHandleAndLog(c, err, true, desc, contestID)
+		tx.Rollback()
+		return err
+	}
+
+	// check in transaction, so that concurrent registrations don't exceed the cap
+	if err := lockContest(tx, contest); err != nil {
+		return nil, rollback(err, "lock contest")
+	}
+	if err := checkNotRegistered(c, tx, contestID, myID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if registration.Status == model.RegistrationApproved {
+		if err := checkContestFull(c, tx, contest); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if isTeamContest(contest) {
+		joinCode, err := uuid.NewV4()
+		if err != nil {
+			tx.Rollback()
+			log.For(ctx).Error("generate uuid fail", zap.Error(err))
+			wrap.SetInternalServerError(c, err)
+			return nil, err
+		}
+
+		team := model.Team{
+			ContestID: contestID,
+			Name:      arg.TeamName,
+			LeaderID:  myID,
+			JoinCode:  joinCode.String(),
+		}
+		if err := tx.Create(&team).Error; err != nil {
+			return nil, rollback(err, "save team")
+		}
+		if err := tx.Model(&team).Association("Members").Append(&model.User{ID: myID}).Error; err != nil {
+			return nil, rollback(err, "add leader to team")
+		}
+		registration.TeamID = team.ID
+	}
+
+	if err := tx.Create(&registration).Error; err != nil {
+		return nil, rollback(err, "save registration")
+	}
+
+	if registration.Status == model.RegistrationApproved {
+		if err := addUsers2Contest(tx, contestID, []int{myID}); err != nil {
+			return nil, rollback(err, "add user to contest")
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, rollback(err, "commit registration")
+	}
+
+	log.For(ctx).Info("success register contest", zap.Int("contestId", contestID),
+		zap.String("status", registration.Status))
+	return getRegistration(c, registration.ID)
+}
+
+// join team by join code, user joins contest directly when registration of team is approved
+func JoinTeam(c *gin.Context, contestID int, arg *data.JoinTeamArg) (*model.Team, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	myID := auth.GetUserFromJWT(c).ID
+
+	contest, err := getContest4Register(c, contestID)
+	if err != nil {
+		return nil, err
+	}
+
+	team := model.Team{}
+	err = db.Preload("Members").Where("contest_id = ? AND join_code = ?", contestID, arg.JoinCode).
+		First(&team).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get team by join code", contestID) != mysql.Success {
+		return nil, err
+	}
+
+	registration := model.ContestRegistration{}
+	err = db.Where("team_id = ?", team.ID).First(&registration).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get registration of team", team.ID) != mysql.Success {
+		return nil, err
+	}
+	if registration.Status == model.RegistrationRejected {
+		log.For(ctx).Error("registration of team is rejected", zap.Int("teamId", team.ID))
+		_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrRegistrationClosed)
+		return nil, kerror.EmptyError
+	}
+
+	tx := db.Begin()
+	rollback := func(err error, desc string) error {
+		mysql.ErrorHandleAndLog(c, err, true, desc, team.ID)
+		tx.Rollback()
+		return err
+	}
+
+	// check in transaction, so that concurrent joins don't exceed the team size
+	if err := lockContest(tx, contest); err != nil {
+		return nil, rollback(err, "lock contest")
+	}
+	if err := checkNotRegistered(c, tx, contestID, myID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	memberCount := 0
+	if err := tx.Table("team_member").Where("team_id = ?", team.ID).Count(&memberCount).Error; err != nil {
+		return nil, rollback(err, "count members of team")
+	}
+	if memberCount >= contest.MaxTeamSize {
+		tx.Rollback()
+		log.For(ctx).Error("team is full", zap.Int("teamId", team.ID))
+		_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrTeamFull.WithArgs(contest.MaxTeamSize))
+		return nil, kerror.EmptyError
+	}
+
+	if err := tx.Model(&team).Association("Members").Append(&model.User{ID: myID}).Error; err != nil {
+		return nil, rollback(err, "add member to team")
+	}
+	if registration.Status == model.RegistrationApproved {
+		if err := addUsers2Contest(tx, contestID, []int{myID}); err != nil {
+			return nil, rollback(err, "add user to contest")
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, rollback(err, "commit join team")
+	}
+
+	log.For(ctx).Info("success join team", zap.Int("teamId", team.ID))
+	return &team, nil
+}
+
+// registration of current user, or registration of team which current user belongs to
+func GetMyRegistration(c *gin.Context, contestID int) (*model.ContestRegistration, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	myID := auth.GetUserFromJWT(c).ID
+
+	registration := model.ContestRegistration{}
+	err := db.Where("contest_id = ?", contestID).
+		Where("user_id = ? OR team_id in (?)", myID,
+			db.Table("team_member").Select("team_id").Where("user_id = ?", myID).SubQuery()).
+		Order("id desc").First(&registration).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get registration of me", contestID) != mysql.Success {
+		return nil, err
+	}
+
+	return getRegistration(c, registration.ID)
+}
+
+// review queue of contest, only for owner
+func GetRegistrations(c *gin.Context, contestID int, arg *data.RegistrationListArg) ([]model.ContestRegistration, error) {
+	var registrations []model.ContestRegistration
+
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	contest, err := GetContest(c, contestID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkContestOwner(c, contest); err != nil {
+		return nil, err
+	}
+
+	queryDB := db.Preload("User").Preload("Team").Preload("Team.Members").Where("contest_id = ?", contestID)
+	if arg.Status != "" {
+		queryDB = queryDB.Where("status = ?", arg.Status)
+	}
+	err = queryDB.Order("id").Find(&registrations).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get registrations of contest", contestID) != mysql.Success {
+		return nil, err
+	}
+
+	log.For(ctx).Info("success get registrations", zap.Int("contestId", contestID))
+	return registrations, nil
+}
+
+// approve or reject pending registration, all members of team join contest when approved
+func ReviewRegistration(c *gin.Context, contestID, id int, arg *data.ReviewArg) (*model.ContestRegistration, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	contest, err := GetContest(c, contestID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkContestOwner(c, contest); err != nil {
+		return nil, err
+	}
+
+	tx := db.Begin()
+	rollback := func(err error, desc string) error {
+		mysql.ErrorHandleAndLog(c, err, true, desc, id)
+		tx.Rollback()
+		return err
+	}
+
+	// check in transaction, so that concurrent approvals don't exceed the cap,
+	// and the registration isn't reviewed twice
+	if err := lockContest(tx, contest); err != nil {
+		return nil, rollback(err, "lock contest")
+	}
+
+	registration := model.ContestRegistration{}
+	err = tx.Preload("Team").Preload("Team.Members").
+		Where("contest_id = ? AND status = ?", contestID, model.RegistrationPending).
+		First(&registration, id).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get pending registration", id) != mysql.Success {
+		tx.Rollback()
+		return nil, err
+	}
+
+	userIDs := []int{registration.UserID}
+	if registration.Team != nil {
+		userIDs = nil
+		for _, member := range registration.Team.Members {
+			userIDs = append(userIDs, member.ID)
+		}
+	}
+
+	if arg.Status == model.RegistrationApproved {
+		if err := checkContestFull(c, tx, contest); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Model(&registration).Update("status", arg.Status).Error; err != nil {
+		return nil, rollback(err, "update status of registration")
+	}
+	if arg.Status == model.RegistrationApproved {
+		if err := addUsers2Contest(tx, contestID, userIDs); err != nil {
+			return nil, rollback(err, "add users to contest")
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, rollback(err, "commit review of registration")
+	}
+
+	log.For(ctx).Info("success review registration", zap.Int("registrationId", id),
+		zap.String("status", arg.Status))
+	return getRegistration(c, id)
+}
+
+// approved teams of contest with members, join code is hidden
+func getTeamsOfContest(c *gin.Context, contestID int) ([]model.Team, error) {
+	var teams []model.Team
+
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	err := db.Preload("Members").Where("id in (?)", db.Model(&model.ContestRegistration{}).
+		Select("team_id").Where("contest_id = ? AND team_id <> 0 AND status = ?",
+		contestID, model.RegistrationApproved).SubQuery()).
+		Order("id").Find(&teams).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get teams of contest", contestID) != mysql.Success {
+		return nil, err
+	}
+
+	for i := range teams {
+		teams[i].JoinCode = ""
+	}
+	return teams, nil
+}
@@ -0,0 +1,31 @@
+package srv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRegistrationOpen(t *testing.T) {
+	start := time.Date(2019, 3, 1, 9, 0, 0, 0, time.Local)
+	contest := &model.Contest{
+		StartTime: start,
+		EndTime:   start.Add(2 * time.Hour),
+	}
+
+	// only join by invite
+	assert.False(t, isRegistrationOpen(contest, start))
+
+	// default deadline is end time
+	contest.RegisterMode = model.RegisterByPublic
+	assert.True(t, isRegistrationOpen(contest, contest.EndTime))
+	assert.False(t, isRegistrationOpen(contest, contest.EndTime.Add(time.Second)))
+
+	deadline := start.Add(-time.Hour)
+	contest.RegisterMode = model.RegisterByApproval
+	contest.RegisterDeadline = &deadline
+	assert.True(t, isRegistrationOpen(contest, deadline))
+	assert.False(t, isRegistrationOpen(contest, start))
+}
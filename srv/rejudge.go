@@ -0,0 +1,426 @@
+package srv
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+	"github.com/si9ma/KillOJ-backend/auth"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/kerror"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/constants"
+	"github.com/si9ma/KillOJ-common/judge"
+	"github.com/si9ma/KillOJ-common/kjson"
+	"github.com/si9ma/KillOJ-common/kredis"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/si9ma/KillOJ-common/mysql"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	RejudgePrefix  = "rejudge_"
+	rejudgeTimeout = 24 * time.Hour
+)
+
+func isAdministrator(c *gin.Context) bool {
+	return auth.GetUserFromJWT(c).Role == int(model.Administrator)
+}
+
+// get problem which user can manage(owner or administrator)
+func getProblem4Manage(c *gin.Context, id int) (*model.Problem, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	if isAdministrator(c) {
+		problem := model.Problem{}
+		err := db.First(&problem, id).Error
+		if mysql.ErrorHandleAndLog(c, err, true, "get problem", id) != mysql.Success {
+			return nil, err
+		}
+		return &problem, nil
+	}
+
+	problem, err := GetProblem(c, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkProblemOwner(c, problem); err != nil {
+		return nil, err
+	}
+
+	return problem, nil
+}
+
+// get contest which user can manage(owner or administrator)
+func getContest4Manage(c *gin.Context, id int) (*model.Contest, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	if isAdministrator(c) {
+		contest := model.Contest{}
+		err := db.First(&contest, id).Error
+		if mysql.ErrorHandleAndLog(c, err, true, "get contest", id) != mysql.Success {
+			return nil, err
+		}
+		return &contest, nil
+	}
+
+	contest, err := GetContest(c, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkContestOwner(c, contest); err != nil {
+		return nil, err
+	}
+
+	return contest, nil
+}
+
+func RejudgeSubmit(c *gin.Context, id int) (*data.RejudgeProgress, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	submit := model.Submit{}
+	err := db.Select("id, problem_id").First(&submit, id).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get submit", id) != mysql.Success {
+		return nil, err
+	}
+
+	// check permission
+	if _, err := getProblem4Manage(c, submit.ProblemID); err != nil {
+		return nil, err
+	}
+
+	return rejudge(c, db.Where("submit.id = ?", id))
+}
+
+func RejudgeProblem(c *gin.Context, id int) (*data.RejudgeProgress, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	// check permission
+	if _, err := getProblem4Manage(c, id); err != nil {
+		return nil, err
+	}
+
+	return rejudge(c, db.Where("submit.problem_id = ?", id))
+}
+
+func RejudgeContest(c *gin.Context, id int) (*data.RejudgeProgress, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	// check permission
+	if _, err := getContest4Manage(c, id); err != nil {
+		return nil, err
+	}
+
+	// submits of archived problems are not rejudged
+	return rejudge(c, db.Joins("join problem on problem.id = submit.problem_id AND"+
+		" problem.belong_type = ? AND problem.belong_to_id = ? AND problem.deleted_at IS NULL",
+		model.BelongToContest, id))
+}
+
+// rejudge all complete submits queried by db,
+// the scoreboard is calculated from submits,
+// so it will be recomputed automatically when rejudge complete
+func rejudge(c *gin.Context, db *gorm.DB) (*data.RejudgeProgress, error) {
+	var submits []model.Submit
+
+	ctx := c.Request.Context()
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+
+	// don't query source code
+	err := db.Select("submit.id, submit.problem_id, submit.user_id, submit.result, submit.language").
+		Where("submit.is_complete = ?", true).Preload("Problem").Find(&submits).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get submits to rejudge", nil) != mysql.Success {
+		return nil, err
+	}
+
+	// generate uuid
+	id, err := uuid.NewV4()
+	if err != nil {
+		log.For(ctx).Error("generate uuid fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return nil, err
+	}
+
+	task := data.RejudgeTask{
+		ID:        id.String(),
+		CreatorID: auth.GetUserFromJWT(c).ID,
+		CreatedAt: time.Now(),
+	}
+	var submitIDs []int
+	for _, submit := range submits {
+		task.Submits = append(task.Submits, data.RejudgeItem{
+			SubmitID:  submit.ID,
+			UserID:    submit.UserID,
+			ProblemID: submit.ProblemID,
+			OldResult: submit.Result,
+		})
+		submitIDs = append(submitIDs, submit.ID)
+	}
+
+	// save rejudge task, task without submit is also saved, so that its progress can be got
+	res, err := kjson.MarshalString(task)
+	if err != nil {
+		log.For(ctx).Error("marshal json fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return nil, err
+	}
+	k := RejudgePrefix + task.ID
+	err = redisCli.Set(k, res, rejudgeTimeout).Err()
+	if kredis.ErrorHandleAndLog(c, err, true,
+		"save rejudge task", k, nil) != kredis.Success {
+		return nil, err
+	}
+
+	// nothing to rejudge
+	if len(submits) == 0 {
+		log.For(ctx).Info("no submit need rejudge")
+		return &data.RejudgeProgress{
+			ID:         task.ID,
+			IsComplete: true,
+		}, nil
+	}
+
+	// reset submits before send task,
+	// otherwise the new result may be overwritten
+	backup, err := resetSubmits(c, submitIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// track submits after reset, otherwise the old result may be collected as new one
+	var judging []data.JudgingSubmit
+	for _, item := range task.Submits {
+		judging = append(judging, data.JudgingSubmit{
+			SubmitID: item.SubmitID,
+			SentAt:   time.Now(),
+			Rejudge:  true,
+		})
+	}
+	if err := trackJudging(c, judging); err != nil {
+		restoreSubmits(c, task.Submits, backup)
+		return nil, err
+	}
+
+	// contest of problems is queried only once
+	fullJudges := make(map[int]bool)
+	for i := range submits {
+		problem := &submits[i].Problem
+		fullJudge, ok := fullJudges[problem.BelongToID]
+		if problem.BelongType != model.BelongToContest {
+			fullJudge = false
+		} else if !ok {
+			if fullJudge, err = needFullJudge(c, problem); err != nil {
+				restoreSubmits(c, task.Submits[i:], backup)
+				return nil, err
+			}
+			fullJudges[problem.BelongToID] = fullJudge
+		}
+
+		if err := submit2Judger(c, &submits[i], problem, fullJudge); err != nil {
+			// restore submits which haven't been sent to judger
+			restoreSubmits(c, task.Submits[i:], backup)
+			return nil, err
+		}
+	}
+
+	log.For(ctx).Info("send rejudge task success", zap.String("rejudgeID", task.ID),
+		zap.Int("submitNum", len(submits)))
+	return &data.RejudgeProgress{
+		ID:    task.ID,
+		Total: len(submits),
+	}, nil
+}
+
+// result of submits before reset, it's restored when fail to send
+type rejudgeBackup struct {
+	results  map[int]model.SubmitResult
+	statuses map[int]string
+}
+
+// mark submits as judging, and remove stale result,
+// removed result is returned for restoring
+func resetSubmits(c *gin.Context, submitIDs []int) (*rejudgeBackup, error) {
+	var results []model.SubmitResult
+
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+
+	backup := rejudgeBackup{
+		results:  make(map[int]model.SubmitResult),
+		statuses: make(map[int]string),
+	}
+	err := db.Where("submit_id in (?)", submitIDs).Find(&results).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get result of submits", submitIDs) != mysql.Success {
+		return nil, err
+	}
+	for _, result := range results {
+		backup.results[result.SubmitID] = result
+	}
+
+	err = db.Model(&model.Submit{}).Where("id in (?)", submitIDs).
+		Updates(map[string]interface{}{
+			"is_complete": false,
+			"result":      judge.JudgingStatus.Code,
+		}).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"reset submits", submitIDs) != mysql.Success {
+		return nil, err
+	}
+
+	err = db.Where("submit_id in (?)", submitIDs).Delete(&model.SubmitResult{}).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"remove result of submits", submitIDs) != mysql.Success {
+		return nil, err
+	}
+
+	for _, id := range submitIDs {
+		k := constants.SubmitStatusKeyPrefix + strconv.Itoa(id)
+		status, err := redisCli.Get(k).Result()
+		if err == nil {
+			backup.statuses[id] = status
+		} else if kredis.ErrorHandleAndLog(c, err, false,
+			"get status of submit", k, id) == kredis.DB_ERROR {
+			return nil, err
+		}
+
+		err = redisCli.Del(k).Err()
+		if kredis.ErrorHandleAndLog(c, err, true,
+			"remove status of submit", k, id) != kredis.Success {
+			return nil, err
+		}
+	}
+
+	return &backup, nil
+}
+
+// restore result of submits and stop tracking them, only log when fail,
+// submit which was tracked before rejudge is still tracked
+func restoreSubmits(c *gin.Context, items []data.RejudgeItem, backup *rejudgeBackup) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+
+	for _, item := range items {
+		err := db.Model(&model.Submit{ID: item.SubmitID}).
+			Updates(map[string]interface{}{
+				"is_complete": true,
+				"result":      item.OldResult,
+			}).Error
+		if err != nil {
+			log.For(ctx).Error("restore submit fail", zap.Error(err), zap.Int("submitID", item.SubmitID))
+		}
+
+		if result, ok := backup.results[item.SubmitID]; ok {
+			if err := db.Save(&result).Error; err != nil {
+				log.For(ctx).Error("restore result of submit fail", zap.Error(err), zap.Int("submitID", item.SubmitID))
+			}
+		}
+
+		if status, ok := backup.statuses[item.SubmitID]; ok {
+			k := constants.SubmitStatusKeyPrefix + strconv.Itoa(item.SubmitID)
+			if err := redisCli.Set(k, status, constants.SubmitStatusTimeout).Err(); err != nil {
+				log.For(ctx).Error("restore status of submit fail", zap.Error(err), zap.Int("submitID", item.SubmitID))
+			}
+		}
+
+		field := strconv.Itoa(item.SubmitID)
+		value, err := redisCli.HGet(JudgingSubmitsKey, field).Result()
+		if err != nil {
+			continue
+		}
+		judging := data.JudgingSubmit{}
+		if err := kjson.UnmarshalString(value, &judging); err == nil && !judging.Rejudge {
+			continue
+		}
+		if err := redisCli.HDel(JudgingSubmitsKey, field).Err(); err != nil {
+			log.For(ctx).Error("stop tracking submit fail", zap.Error(err), zap.Int("submitID", item.SubmitID))
+		}
+	}
+}
+
+func GetRejudgeProgress(c *gin.Context, rejudgeID string) (*data.RejudgeProgress, error) {
+	var submits []model.Submit
+
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+	myID := auth.GetUserFromJWT(c).ID
+
+	k := RejudgePrefix + rejudgeID
+	res, err := redisCli.Get(k).Result()
+	if kredis.ErrorHandleAndLog(c, err, true,
+		"get rejudge task", k, rejudgeID) != kredis.Success {
+		return nil, err
+	}
+
+	task := data.RejudgeTask{}
+	if err := kjson.UnmarshalString(res, &task); err != nil {
+		log.For(ctx).Error("unmarshal fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return nil, err
+	}
+
+	// only creator and administrator can access
+	if task.CreatorID != myID && !isAdministrator(c) {
+		err = fmt.Errorf("access rejudge task forbidden")
+		log.For(ctx).Error("access rejudge task fail(forbidden)", zap.String("rejudgeID", rejudgeID))
+		_ = c.Error(err).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrForbiddenGeneral)
+		return nil, err
+	}
+
+	progress := data.RejudgeProgress{
+		ID:    task.ID,
+		Total: len(task.Submits),
+	}
+	if len(task.Submits) == 0 {
+		progress.IsComplete = true
+		return &progress, nil
+	}
+
+	items := make(map[int]data.RejudgeItem)
+	var submitIDs []int
+	for _, item := range task.Submits {
+		items[item.SubmitID] = item
+		submitIDs = append(submitIDs, item.SubmitID)
+	}
+
+	err = db.Select("id, result, is_complete").Where("id in (?)", submitIDs).Find(&submits).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get submits of rejudge task", rejudgeID) != mysql.Success {
+		return nil, err
+	}
+
+	for _, submit := range submits {
+		if !submit.IsComplete {
+			continue
+		}
+
+		progress.Completed++
+		if item := items[submit.ID]; item.OldResult != submit.Result {
+			progress.Changes = append(progress.Changes, data.VerdictChange{
+				SubmitID:  item.SubmitID,
+				UserID:    item.UserID,
+				ProblemID: item.ProblemID,
+				OldResult: item.OldResult,
+				NewResult: submit.Result,
+			})
+		}
+	}
+	progress.IsComplete = progress.Completed == progress.Total
+
+	return &progress, nil
+}
@@ -0,0 +1,329 @@
+package srv
+
+import (
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/si9ma/KillOJ-backend/auth"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-common/judge"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/si9ma/KillOJ-common/mysql"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+// penalty minutes for every wrong attempt before first accepted
+const penaltyPerWrongAttempt = 20
+
+// full score of a problem in OI mode
+const fullScore = 100
+
+// compile error and system error are not the fault of the answer,
+// so they don't count as wrong attempt
+func isPenaltyResult(result int) bool {
+	return result != judge.AcceptedStatus.Code &&
+		result != judge.CompileErrorStatus.Code &&
+		result != judge.SystemErrorStatus.Code
+}
+
+func GetScoreboard(c *gin.Context, id int) (*data.Scoreboard, error) {
+	var (
+		problems  []model.Problem
+		testCases []model.ProblemTestCase
+		users     []model.User
+		submits   []model.Submit
+	)
+
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	myID := auth.GetUserFromJWT(c).ID
+
+	// check if contest exist, scoreboard of archived contest is kept
+	contest, err := getContest4History(c, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// problems are hidden before contest start
+	if err := checkContestStarted(c, contest); err != nil {
+		return nil, err
+	}
+
+	// problems of contest, archived problems are kept for history
+	err = db.Unscoped().Where("belong_type = ? AND belong_to_id = ?", model.BelongToContest, id).
+		Order("id").Find(&problems).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get problems of contest", id) != mysql.Success {
+		return nil, err
+	}
+
+	// weight of test cases, only for OI mode
+	weights := make(map[int]map[int]int)
+	if contest.ScoreMode != model.ScoreModeACM && len(problems) > 0 {
+		var problemIDs []int
+		for _, problem := range problems {
+			problemIDs = append(problemIDs, problem.ID)
+		}
+
+		// don't query test data
+		err = db.Select("id, problem_id, weight").Where("problem_id in (?)", problemIDs).
+			Find(&testCases).Error
+		if mysql.ErrorHandleAndLog(c, err, true,
+			"get test cases of contest", id) != mysql.Success {
+			return nil, err
+		}
+
+		for _, testCase := range testCases {
+			if _, ok := weights[testCase.ProblemID]; !ok {
+				weights[testCase.ProblemID] = make(map[int]int)
+			}
+			weights[testCase.ProblemID][testCase.ID] = testCase.Weight
+		}
+	}
+
+	// participants of contest
+	err = db.Model(contest).Association("Users").Find(&users).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get users of contest", id) != mysql.Success {
+		return nil, err
+	}
+
+	// submits during contest
+	submitDB, err := GetAllSubmitOfContest(c, id, true)
+	if err != nil {
+		return nil, err
+	}
+	err = submitDB.Where("is_complete = ?", true).
+		Order("submit.created_at").Order("submit.id").Find(&submits).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get submits of contest", id) != mysql.Success {
+		return nil, err
+	}
+
+	// the owner can always see the real scoreboard
+	var frozenAt *time.Time
+	if contest.FrozenTime > 0 && contest.OwnerID != myID {
+		t := contest.EndTime.Add(-time.Duration(contest.FrozenTime) * time.Minute)
+		frozenAt = &t
+	}
+
+	// approved teams of team contest
+	var teams []model.Team
+	if isTeamContest(contest) {
+		if teams, err = getTeamsOfContest(c, id); err != nil {
+			return nil, err
+		}
+	}
+
+	board := calcScoreboard(contest, problems, weights, users, teams, submits, frozenAt, time.Now())
+
+	// ghost entries of virtual participations
+	virtualRows, err := getVirtualRows(c, contest, problems, weights)
+	if err != nil {
+		return nil, err
+	}
+	if len(virtualRows) > 0 {
+		board.Rows = append(board.Rows, virtualRows...)
+		rankScoreboard(board.Rows, contest.ScoreMode)
+	}
+
+	log.For(ctx).Info("success get scoreboard", zap.Int("contestID", id))
+	return board, nil
+}
+
+// calculate weighted score of submit,
+// weights is test case id -> weight, weight 0 is treated as 1,
+// test cases are treated as same weight when passed cases aren't reported by judger
+func calcSubmitScore(submit *model.Submit, weights map[int]int) int {
+	if submit.Result == judge.AcceptedStatus.Code {
+		return fullScore
+	}
+	if len(submit.PassedCases) == 0 && submit.CaseNum > 0 {
+		return submit.PassedNum * fullScore / submit.CaseNum
+	}
+
+	total, passed := 0, 0
+	for id, weight := range weights {
+		if weight == 0 {
+			weight = 1
+		}
+		total += weight
+		if submit.PassedCases.Contains(id) {
+			passed += weight
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+	return passed * fullScore / total
+}
+
+// calculate ACM/ICPC style or OI style scoreboard,
+// weights is problem id -> test case id -> weight, only for OI mode,
+// teams are ranked as one entry, members of teams should also be in users,
+// submits should be sorted by submit time,
+// submits after frozenAt are counted as pending when frozenAt isn't nil,
+// scoreboard is unfrozen after contest end
+func calcScoreboard(contest *model.Contest, problems []model.Problem, weights map[int]map[int]int,
+	users []model.User, teams []model.Team, submits []model.Submit, frozenAt *time.Time, now time.Time) *data.Scoreboard {
+	board := &data.Scoreboard{
+		ContestID: contest.ID,
+		ScoreMode: contest.ScoreMode,
+		StartTime: contest.StartTime,
+		EndTime:   contest.EndTime,
+		FrozenAt:  frozenAt,
+		IsFrozen:  frozenAt != nil && now.After(*frozenAt) && !now.After(contest.EndTime),
+	}
+
+	// problem id -> index
+	probIndex := make(map[int]int)
+	for i, problem := range problems {
+		probIndex[problem.ID] = i
+		board.Problems = append(board.Problems, data.ScoreboardProb{
+			ID:   problem.ID,
+			Name: problem.Name,
+		})
+	}
+
+	newRow := func(user model.User, team *model.Team) int {
+		row := data.ScoreboardEntry{
+			User:     user,
+			Team:     team,
+			Problems: make([]data.ProblemScoreCell, len(problems)),
+		}
+		for j, problem := range problems {
+			row.Problems[j].ProblemID = problem.ID
+		}
+		board.Rows = append(board.Rows, row)
+		return len(board.Rows) - 1
+	}
+
+	// user id -> index, members of team share the row of team
+	userIndex := make(map[int]int)
+	for i := range teams {
+		leader := model.User{ID: teams[i].LeaderID}
+		for _, member := range teams[i].Members {
+			if member.ID == leader.ID {
+				leader = member
+			}
+		}
+
+		index := newRow(leader, &teams[i])
+		for _, member := range teams[i].Members {
+			userIndex[member.ID] = index
+		}
+	}
+	for _, user := range users {
+		if _, ok := userIndex[user.ID]; ok {
+			continue
+		}
+		userIndex[user.ID] = newRow(user, nil)
+	}
+
+	firstBlood := make(map[int]bool) // problem id -> already have first blood
+	for _, submit := range submits {
+		pi, ok := probIndex[submit.ProblemID]
+		if !ok {
+			continue
+		}
+		ui, ok := userIndex[submit.UserID]
+		if !ok {
+			// not participant, eg: owner of contest
+			continue
+		}
+
+		row := &board.Rows[ui]
+		cell := &row.Problems[pi]
+		if cell.IsAccepted && contest.ScoreMode != model.ScoreModeOILast {
+			continue
+		}
+
+		// after frozen
+		if board.IsFrozen && submit.CreatedAt.After(*frozenAt) {
+			cell.PendingCount++
+			board.Problems[pi].TriedCount++
+			continue
+		}
+
+		isAccepted := submit.Result == judge.AcceptedStatus.Code
+		if isAccepted && !firstBlood[submit.ProblemID] {
+			firstBlood[submit.ProblemID] = true
+			cell.IsFirstBlood = true
+		}
+		board.Problems[pi].TriedCount++
+
+		switch contest.ScoreMode {
+		case model.ScoreModeOIBest, model.ScoreModeOILast:
+			score := calcSubmitScore(&submit, weights[submit.ProblemID])
+			if contest.ScoreMode == model.ScoreModeOILast || score > cell.Score {
+				cell.Score = score
+			}
+			cell.Attempts++
+			if isAccepted || contest.ScoreMode == model.ScoreModeOILast {
+				cell.IsAccepted = isAccepted
+				cell.AcceptedAt = int(submit.CreatedAt.Sub(contest.StartTime) / time.Minute)
+			}
+		default:
+			if isAccepted {
+				cell.IsAccepted = true
+				cell.AcceptedAt = int(submit.CreatedAt.Sub(contest.StartTime) / time.Minute)
+				row.Penalty += cell.AcceptedAt + cell.Attempts*penaltyPerWrongAttempt
+			} else if isPenaltyResult(submit.Result) {
+				cell.Attempts++
+			}
+		}
+	}
+
+	// sum
+	for i := range board.Rows {
+		row := &board.Rows[i]
+		for j, cell := range row.Problems {
+			if cell.IsAccepted {
+				row.Solved++
+				board.Problems[j].SolvedCount++
+			}
+			row.Score += cell.Score
+		}
+	}
+
+	rankScoreboard(board.Rows, contest.ScoreMode)
+	return board
+}
+
+// ACM mode: more solved, less penalty, higher rank,
+// OI mode: higher score, higher rank,
+// entries with same solved and penalty(or same score) have same rank
+func rankScoreboard(rows []data.ScoreboardEntry, mode model.ScoreMode) {
+	isTie := func(a, b *data.ScoreboardEntry) bool {
+		if mode != model.ScoreModeACM {
+			return a.Score == b.Score
+		}
+		return a.Solved == b.Solved && a.Penalty == b.Penalty
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if mode != model.ScoreModeACM && rows[i].Score != rows[j].Score {
+			return rows[i].Score > rows[j].Score
+		}
+		if mode == model.ScoreModeACM && rows[i].Solved != rows[j].Solved {
+			return rows[i].Solved > rows[j].Solved
+		}
+		if mode == model.ScoreModeACM && rows[i].Penalty != rows[j].Penalty {
+			return rows[i].Penalty < rows[j].Penalty
+		}
+		return rows[i].User.ID < rows[j].User.ID
+	})
+
+	for i := range rows {
+		if i > 0 && isTie(&rows[i], &rows[i-1]) {
+			rows[i].Rank = rows[i-1].Rank
+		} else {
+			rows[i].Rank = i + 1
+		}
+	}
+}
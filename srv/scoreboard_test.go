@@ -0,0 +1,134 @@
+package srv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/si9ma/KillOJ-common/judge"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalcScoreboard(t *testing.T) {
+	start := time.Date(2019, 6, 1, 8, 0, 0, 0, time.UTC)
+	contest := &model.Contest{
+		ID:        1,
+		StartTime: start,
+		EndTime:   start.Add(5 * time.Hour),
+	}
+	problems := []model.Problem{{ID: 10}, {ID: 11}}
+	users := []model.User{{ID: 1}, {ID: 2}, {ID: 3}}
+	at := func(minute int) time.Time {
+		return start.Add(time.Duration(minute) * time.Minute)
+	}
+	submits := []model.Submit{
+		{UserID: 1, ProblemID: 10, Result: judge.WrongAnswerStatus.Code, CreatedAt: at(5)},
+		{UserID: 1, ProblemID: 10, Result: judge.CompileErrorStatus.Code, CreatedAt: at(8)},
+		{UserID: 2, ProblemID: 10, Result: judge.AcceptedStatus.Code, CreatedAt: at(9)},
+		{UserID: 1, ProblemID: 10, Result: judge.AcceptedStatus.Code, CreatedAt: at(10)},
+		{UserID: 1, ProblemID: 11, Result: judge.AcceptedStatus.Code, CreatedAt: at(30)},
+		{UserID: 2, ProblemID: 11, Result: judge.AcceptedStatus.Code, CreatedAt: at(40)},
+		{UserID: 3, ProblemID: 11, Result: judge.AcceptedStatus.Code, CreatedAt: at(290)},
+	}
+
+	board := calcScoreboard(contest, problems, nil, users, nil, submits, nil, at(400))
+	assert.False(t, board.IsFrozen)
+
+	// user 1: 10 + 20 + 30 = 60, user 2: 9 + 40 = 49
+	assert.Equal(t, 2, board.Rows[0].User.ID)
+	assert.Equal(t, 49, board.Rows[0].Penalty)
+	assert.True(t, board.Rows[0].Problems[0].IsFirstBlood)
+	assert.Equal(t, 1, board.Rows[1].User.ID)
+	assert.Equal(t, 60, board.Rows[1].Penalty)
+	assert.Equal(t, 1, board.Rows[1].Problems[0].Attempts)
+	assert.True(t, board.Rows[1].Problems[1].IsFirstBlood)
+	assert.Equal(t, 3, board.Rows[2].Rank)
+	assert.Equal(t, 2, board.Problems[0].SolvedCount)
+
+	// freeze the last hour
+	frozenAt := at(240)
+	board = calcScoreboard(contest, problems, nil, users, nil, submits, &frozenAt, at(300))
+	assert.True(t, board.IsFrozen)
+	assert.Equal(t, 3, board.Rows[2].User.ID)
+	assert.Equal(t, 0, board.Rows[2].Solved)
+	assert.Equal(t, 1, board.Rows[2].Problems[1].PendingCount)
+
+	// unfrozen after contest end
+	board = calcScoreboard(contest, problems, nil, users, nil, submits, &frozenAt, at(400))
+	assert.False(t, board.IsFrozen)
+	assert.Equal(t, 1, board.Rows[2].Solved)
+}
+
+func TestRankScoreboardTie(t *testing.T) {
+	start := time.Date(2019, 6, 1, 8, 0, 0, 0, time.UTC)
+	contest := &model.Contest{StartTime: start, EndTime: start.Add(time.Hour)}
+	users := []model.User{{ID: 1}, {ID: 2}, {ID: 3}}
+
+	board := calcScoreboard(contest, nil, nil, users, nil, nil, nil, start)
+	for _, row := range board.Rows {
+		assert.Equal(t, 1, row.Rank)
+	}
+}
+
+func TestCalcScoreboardOI(t *testing.T) {
+	start := time.Date(2019, 6, 1, 8, 0, 0, 0, time.UTC)
+	contest := &model.Contest{
+		StartTime: start,
+		EndTime:   start.Add(2 * time.Hour),
+		ScoreMode: model.ScoreModeOIBest,
+	}
+	problems := []model.Problem{{ID: 10}}
+	weights := map[int]map[int]int{
+		10: {1: 1, 2: 3, 3: 0},
+	}
+	users := []model.User{{ID: 1}, {ID: 2}}
+	submits := []model.Submit{
+		{UserID: 1, ProblemID: 10, Result: judge.WrongAnswerStatus.Code, PassedCases: model.IntSlice{2}, CreatedAt: start},
+		{UserID: 1, ProblemID: 10, Result: judge.WrongAnswerStatus.Code, PassedCases: model.IntSlice{1}, CreatedAt: start},
+		{UserID: 2, ProblemID: 10, Result: judge.RunTimeOutStatus.Code, PassedCases: model.IntSlice{1, 3}, CreatedAt: start},
+	}
+
+	board := calcScoreboard(contest, problems, weights, users, nil, submits, nil, start)
+	assert.Equal(t, 1, board.Rows[0].User.ID)
+	assert.Equal(t, 60, board.Rows[0].Score)
+	assert.Equal(t, 2, board.Rows[0].Problems[0].Attempts)
+	assert.Equal(t, 40, board.Rows[1].Score)
+
+	// last submit
+	contest.ScoreMode = model.ScoreModeOILast
+	board = calcScoreboard(contest, problems, weights, users, nil, submits, nil, start)
+	assert.Equal(t, 2, board.Rows[0].User.ID)
+	assert.Equal(t, 20, board.Rows[1].Score)
+}
+
+func TestCalcSubmitScoreWithoutPassedCases(t *testing.T) {
+	weights := map[int]int{1: 1, 2: 3}
+	submit := &model.Submit{Result: judge.WrongAnswerStatus.Code, PassedNum: 1, CaseNum: 4}
+	assert.Equal(t, 25, calcSubmitScore(submit, weights))
+
+	submit.PassedCases = model.IntSlice{2}
+	assert.Equal(t, 75, calcSubmitScore(submit, weights))
+}
+
+func TestCalcScoreboardTeam(t *testing.T) {
+	start := time.Date(2019, 6, 1, 8, 0, 0, 0, time.UTC)
+	contest := &model.Contest{StartTime: start, EndTime: start.Add(time.Hour)}
+	problems := []model.Problem{{ID: 10}, {ID: 11}}
+	users := []model.User{{ID: 1}, {ID: 2}, {ID: 3}}
+	teams := []model.Team{{ID: 7, LeaderID: 2, Members: []model.User{{ID: 1}, {ID: 2}}}}
+	submits := []model.Submit{
+		{UserID: 1, ProblemID: 10, Result: judge.AcceptedStatus.Code, CreatedAt: start.Add(10 * time.Minute)},
+		{UserID: 3, ProblemID: 10, Result: judge.AcceptedStatus.Code, CreatedAt: start.Add(5 * time.Minute)},
+		{UserID: 2, ProblemID: 11, Result: judge.AcceptedStatus.Code, CreatedAt: start.Add(20 * time.Minute)},
+	}
+
+	board := calcScoreboard(contest, problems, nil, users, teams, submits, nil, start)
+	if assert.Len(t, board.Rows, 2) {
+		assert.Equal(t, 7, board.Rows[0].Team.ID)
+		assert.Equal(t, 2, board.Rows[0].User.ID)
+		assert.Equal(t, 2, board.Rows[0].Solved)
+		assert.Equal(t, 30, board.Rows[0].Penalty)
+		assert.Nil(t, board.Rows[1].Team)
+		assert.Equal(t, 3, board.Rows[1].User.ID)
+	}
+}
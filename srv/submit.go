@@ -1,16 +1,59 @@
 package srv
 
 import (
+	"fmt"
+	"strconv"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
 	"github.com/si9ma/KillOJ-backend/auth"
+	"github.com/si9ma/KillOJ-backend/data"
 	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/kerror"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/constants"
+	"github.com/si9ma/KillOJ-common/judge"
+	"github.com/si9ma/KillOJ-common/kjson"
+	"github.com/si9ma/KillOJ-common/kredis"
 	"github.com/si9ma/KillOJ-common/log"
 	"github.com/si9ma/KillOJ-common/model"
 	"github.com/si9ma/KillOJ-common/mysql"
 	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
 )
 
+// interval to check judge status of submit
+const ResultPollInterval = 500 * time.Millisecond
+
+var allStatus = []judge.Status{
+	judge.AcceptedStatus,
+	judge.JudgingStatus,
+	judge.RuntimeErrorStatus,
+	judge.CompileErrorStatus,
+	judge.RunTimeOutStatus,
+	judge.OOMStatus,
+	judge.WrongAnswerStatus,
+	judge.SystemErrorStatus,
+	judge.ProtocolErrorStatus,
+}
+
+// include archived records when preload
+func withArchived(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
+
+// get status by code, return NullStatus when don't exist
+func statusOfCode(code int) judge.Status {
+	for _, status := range allStatus {
+		if status.Code == code {
+			return status
+		}
+	}
+
+	return judge.NullStatus
+}
+
 func GetAllSubmitOfGroup(c *gin.Context, id int) (*gorm.DB, error) {
 	ctx := c.Request.Context()
 	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
@@ -37,7 +80,8 @@ func GetAllSubmitOfContest(c *gin.Context, id int, onlyDuringContest bool) (*gor
 		" problem.belong_type = 2 AND problem.belong_to_id = ?", id)
 
 	if onlyDuringContest {
-		db = db.Where("created_at BETWEEN '?' AND '?'", contest.StartTime, contest.EndTime)
+		db = db.Where("submit.created_at BETWEEN ? AND ? AND submit.out_of_contest = ?",
+			contest.StartTime, contest.EndTime, false)
 	}
 
 	return db, nil
@@ -70,14 +114,16 @@ func GetAllSubmitOfUser(c *gin.Context, id int) (*gorm.DB, error) {
 	return db.Where("user_id = ?", id), nil
 }
 
-func GetAllSubmit(c *gin.Context, page, pageSize int, order string, of string, id int, onlyDuringContest bool) ([]model.Submit, error) {
+func GetAllSubmit(c *gin.Context, spec *data.PageSpec, of string, id int, onlyDuringContest bool) (*data.PageResult, error) {
 	var err error
 	var submits []model.Submit
 
 	ctx := c.Request.Context()
 	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
 
-	offset := (page - 1) * pageSize
+	if err := CheckSort(c, spec.Sorts, submitSortFields); err != nil {
+		return nil, err
+	}
 
 	switch of {
 	case "group":
@@ -96,13 +142,17 @@ func GetAllSubmit(c *gin.Context, page, pageSize int, order string, of string, i
 		return nil, err
 	}
 
-	queryDB := db.Where("is_complete = ?", true).Preload("User").Preload("Problem").Limit(pageSize).Offset(offset)
-
-	if order != "" {
-		err = queryDB.Order(order).Find(&submits).Error
-	} else {
-		err = queryDB.Find(&submits).Error
+	db = db.Where("is_complete = ?", true)
+	total, err := CountRows(c, db.Model(&model.Submit{}), "count submits")
+	if err != nil {
+		return nil, err
 	}
+
+	// problem of historical submit may be archived
+	queryDB := OrderBy(db, spec.Sorts, submitSortFields).
+		Preload("User").Preload("Problem", withArchived).
+		Limit(spec.Limit).Offset(spec.Offset)
+	err = queryDB.Find(&submits).Error
 	// error handle
 	if mysql.ErrorHandleAndLog(c, err, true,
 		"get submits", nil) != mysql.Success {
@@ -110,7 +160,7 @@ func GetAllSubmit(c *gin.Context, page, pageSize int, order string, of string, i
 	}
 
 	log.For(ctx).Info("success get submits")
-	return submits, nil
+	return NewPageResult(spec, total, submits), nil
 }
 
 func GetSubmit(c *gin.Context, id int) (*model.Submit, error) {
@@ -118,7 +168,7 @@ func GetSubmit(c *gin.Context, id int) (*model.Submit, error) {
 	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
 
 	submit := model.Submit{}
-	err := db.Preload("Problem").Preload("User").First(&submit, id).Error
+	err := db.Preload("Problem", withArchived).Preload("User").First(&submit, id).Error
 
 	// error handle
 	if mysql.ErrorHandleAndLog(c, err, true,
@@ -126,10 +176,128 @@ func GetSubmit(c *gin.Context, id int) (*model.Submit, error) {
 		return nil, err
 	}
 
-	// check if user has permission
-	if _, err := GetProblem(c, submit.ProblemID, false); err != nil {
+	// check if user has permission,
+	// submit of archived problem is only visible to submitter and owner of problem
+	if submit.Problem.DeletedAt != nil {
+		if err := CheckSubmitResultPermission(c, &submit); err != nil {
+			return nil, err
+		}
+	} else if _, err := GetProblem(c, submit.ProblemID, false); err != nil {
 		return nil, err
 	}
 
 	return &submit, nil
 }
+
+// only the submitter and the owner of problem can see the result detail of submit,
+// because the detail contain input and expected output of test case
+func CheckSubmitResultPermission(c *gin.Context, submit *model.Submit) error {
+	ctx := c.Request.Context()
+	myID := auth.GetUserFromJWT(c).ID
+
+	if submit.UserID == myID || submit.Problem.OwnerID == myID {
+		return nil
+	}
+
+	err := fmt.Errorf("access result of submit forbidden")
+	log.For(ctx).Error("access result of submit fail(forbidden)", zap.Int("submitID", submit.ID))
+	_ = c.Error(err).SetType(gin.ErrorTypePublic).
+		SetMeta(kerror.ErrForbiddenGeneral)
+	return err
+}
+
+// get current judge status of submit,
+// the status reported by judger in redis is preferred,
+// if it's not exist, use saved result detail or build result from submit when submit is complete,
+// otherwise return judging status
+func GetSubmitStatus(c *gin.Context, submitID int) (*judge.OuterResult, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+
+	// status from judger
+	k := constants.SubmitStatusKeyPrefix + strconv.Itoa(submitID)
+	res, err := redisCli.Get(k).Result()
+	switch kredis.ErrorHandleAndLog(c, err, false, "get status of submit", k, submitID) {
+	case kredis.Success:
+		result := judge.OuterResult{}
+		if err := kjson.UnmarshalString(res, &result); err != nil {
+			log.For(ctx).Error("unmarshal status of submit fail", zap.Error(err), zap.Int("submitID", submitID))
+			wrap.SetInternalServerError(c, err)
+			return nil, err
+		}
+		return &result, nil
+	case kredis.DB_ERROR:
+		return nil, err
+	}
+
+	// status not exist in redis
+	submit := model.Submit{}
+	err = db.Select("id, result, run_time, memory_usage, is_complete").First(&submit, submitID).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get submit", submitID) != mysql.Success {
+		return nil, err
+	}
+
+	if !submit.IsComplete {
+		return &judge.OuterResult{
+			ID:     strconv.Itoa(submitID),
+			Status: judge.JudgingStatus,
+		}, nil
+	}
+
+	// saved result detail
+	submitResult := model.SubmitResult{}
+	err = db.First(&submitResult, submitID).Error
+	switch mysql.ErrorHandleAndLog(c, err, false, "get result of submit", submitID) {
+	case mysql.Success:
+		result := judge.OuterResult{}
+		if err := kjson.UnmarshalString(string(submitResult.Detail), &result); err != nil {
+			log.For(ctx).Error("unmarshal result of submit fail", zap.Error(err), zap.Int("submitID", submitID))
+			wrap.SetInternalServerError(c, err)
+			return nil, err
+		}
+		return &result, nil
+	case mysql.DB_ERROR:
+		return nil, err
+	}
+
+	// the detail is lost, only summary
+	return &judge.OuterResult{
+		ID:         strconv.Itoa(submitID),
+		Status:     statusOfCode(submit.Result),
+		Runtime:    int64(submit.RunTime),
+		Memory:     int64(submit.MemoryUsage),
+		IsComplete: true,
+	}, nil
+}
+
+// get full judge result of submit
+func GetSubmitResult(c *gin.Context, submitID int) (*judge.OuterResult, error) {
+	ctx := c.Request.Context()
+
+	submit, err := GetSubmit(c, submitID)
+	if err != nil {
+		return nil, err
+	}
+
+	// check permission
+	if err := CheckSubmitResultPermission(c, submit); err != nil {
+		return nil, err
+	}
+
+	result, err := GetSubmitStatus(c, submitID)
+	if err != nil {
+		return nil, err
+	}
+
+	// task haven't complete
+	if !result.IsComplete {
+		log.For(ctx).Info("submit haven't complete", zap.Int("submitID", submitID))
+		_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrNotComplete)
+		return nil, kerror.EmptyError
+	}
+
+	return result, nil
+}
@@ -0,0 +1,539 @@
+package srv
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	uuid "github.com/satori/go.uuid"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/kerror"
+	"github.com/si9ma/KillOJ-backend/store"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/kredis"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/si9ma/KillOJ-common/mysql"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	TestDataInput  = "input"
+	TestDataOutput = "output"
+
+	testDataKeyPrefix   = "test_cases/"
+	snapshotKeyPrefix   = "test_cases/sha256/" // inline test data in revisions, key is checksum of data
+	inlineTestDataLimit = 64 << 10             // test data larger than 64KB is moved to store
+
+	// sorted set of keys which may be unreferenced, score is the time when marked,
+	// keys are checked after delay, so that keys of running update aren't removed
+	TestDataGarbageKey   = "killoj_test_data_garbage"
+	testDataGarbageDelay = time.Hour
+
+	// columns of test case except inline test data
+	testCaseMetaColumns = "id, problem_id, input_key, input_size, input_sum, output_key, output_size, output_sum, weight"
+)
+
+// save data to store, return key, size and sha256 checksum of data,
+// data is spooled to a temp file, so that it can be streamed with known size
+func putTestData(c *gin.Context, r io.Reader, kind string) (string, int64, string, error) {
+	ctx := c.Request.Context()
+
+	tmp, err := ioutil.TempFile("", "testdata-")
+	if err != nil {
+		log.For(ctx).Error("create temp file fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return "", 0, "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(tmp, io.TeeReader(r, hash))
+	if err != nil && size >= gbl.MaxTestDataSize {
+		log.For(ctx).Error("test data is too large", zap.Error(err), zap.Int64("size", size))
+		_ = c.Error(err).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrTooLarge.WithArgs(kind, gbl.MaxTestDataSize))
+		return "", 0, "", err
+	} else if err != nil {
+		log.For(ctx).Error("receive test data fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return "", 0, "", err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		log.For(ctx).Error("seek temp file fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return "", 0, "", err
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		log.For(ctx).Error("generate uuid fail", zap.Error(err))
+		wrap.SetInternalServerError(c, err)
+		return "", 0, "", err
+	}
+	key := testDataKeyPrefix + id.String() + "." + kind
+
+	if err := gbl.Store.Put(ctx, key, tmp, size); err != nil {
+		log.For(ctx).Error("save test data to store fail", zap.Error(err), zap.String("key", key))
+		wrap.SetInternalServerError(c, err)
+		return "", 0, "", err
+	}
+
+	return key, size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// remove test data from store, only log when fail
+func removeTestData(c *gin.Context, keys []string) {
+	ctx := c.Request.Context()
+
+	for _, key := range keys {
+		if err := gbl.Store.Delete(ctx, key); err != nil {
+			log.For(ctx).Error("remove test data fail", zap.Error(err), zap.String("key", key))
+		}
+	}
+}
+
+// mark keys which may be unreferenced, they are removed by CleanTestData
+// when not referenced by test cases or revisions, only log when fail
+func markTestDataGarbage(c *gin.Context, keys []string) {
+	ctx := c.Request.Context()
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+
+	if len(keys) == 0 {
+		return
+	}
+
+	now := float64(time.Now().Unix())
+	var members []redis.Z
+	for _, key := range keys {
+		members = append(members, redis.Z{Score: now, Member: key})
+	}
+	if err := redisCli.ZAdd(TestDataGarbageKey, members...).Err(); err != nil {
+		log.For(ctx).Error("mark unreferenced test data fail", zap.Error(err), zap.Strings("keys", keys))
+	}
+}
+
+// count of test cases and revisions which reference test data
+func countTestDataRefs(c *gin.Context, key string) (int, int, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	cases := 0
+	err := db.Model(&model.ProblemTestCase{}).Where("input_key = ? OR output_key = ?", key, key).
+		Count(&cases).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"count test cases reference test data", key) != mysql.Success {
+		return 0, 0, err
+	}
+
+	revisions := 0
+	pattern := "%" + escapeLike(`"`+key+`"`) + "%"
+	err = db.Model(&model.ProblemUpdateLog{}).Where("before_log LIKE ? OR after_log LIKE ?", pattern, pattern).
+		Count(&revisions).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"count revisions reference test data", key) != mysql.Success {
+		return 0, 0, err
+	}
+
+	return cases, revisions, nil
+}
+
+// remove marked test data which isn't referenced by test cases or revisions,
+// test data only referenced by revisions is checked again next time, because revisions may be pruned
+func CleanTestData(c *gin.Context) (*data.TestDataCleanResult, error) {
+	ctx := c.Request.Context()
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+
+	max := strconv.FormatInt(time.Now().Add(-testDataGarbageDelay).Unix(), 10)
+	keys, err := redisCli.ZRangeByScore(TestDataGarbageKey, redis.ZRangeBy{Min: "-inf", Max: max}).Result()
+	if kredis.ErrorHandleAndLog(c, err, true,
+		"get marked test data", TestDataGarbageKey, nil) != kredis.Success {
+		return nil, err
+	}
+
+	result := data.TestDataCleanResult{Checked: len(keys)}
+	for _, key := range keys {
+		cases, revisions, err := countTestDataRefs(c, key)
+		if err != nil {
+			return nil, err
+		}
+		if cases == 0 && revisions > 0 {
+			continue
+		}
+
+		if cases == 0 {
+			if err := gbl.Store.Delete(ctx, key); err != nil {
+				log.For(ctx).Error("remove test data fail", zap.Error(err), zap.String("key", key))
+				wrap.SetInternalServerError(c, err)
+				return nil, err
+			}
+			result.Removed++
+		}
+
+		err = redisCli.ZRem(TestDataGarbageKey, key).Err()
+		if kredis.ErrorHandleAndLog(c, err, true,
+			"unmark test data", TestDataGarbageKey, key) != kredis.Success {
+			return nil, err
+		}
+	}
+
+	log.For(ctx).Info("clean test data success", zap.Int("checked", result.Checked),
+		zap.Int("removed", result.Removed))
+	return &result, nil
+}
+
+// save inline test data of snapshot to store by checksum, return key, size and checksum,
+// data already saved by other snapshot is reused
+func putSnapshotData(c *gin.Context, content string) (string, int64, string, error) {
+	ctx := c.Request.Context()
+
+	sum := sha256.Sum256([]byte(content))
+	checksum := hex.EncodeToString(sum[:])
+	key, size := snapshotKeyPrefix+checksum, int64(len(content))
+
+	// the update may fail after snapshot is taken, mark it before saving,
+	// so that reused test data isn't removed before revision is committed
+	markTestDataGarbage(c, []string{key})
+
+	r, err := gbl.Store.Get(ctx, key)
+	if err == nil {
+		r.Close()
+		return key, size, checksum, nil
+	} else if err != store.ErrNotFound {
+		log.For(ctx).Error("get test data of snapshot fail", zap.Error(err), zap.String("key", key))
+		wrap.SetInternalServerError(c, err)
+		return "", 0, "", err
+	}
+
+	if err := gbl.Store.Put(ctx, key, strings.NewReader(content), size); err != nil {
+		log.For(ctx).Error("save test data of snapshot fail", zap.Error(err), zap.String("key", key))
+		wrap.SetInternalServerError(c, err)
+		return "", 0, "", err
+	}
+
+	return key, size, checksum, nil
+}
+
+// move large inline test data to store, return keys of moved test data,
+// moved test data is removed when fail
+func offloadTestCases(c *gin.Context, problem *model.Problem) ([]string, error) {
+	var keys []string
+	for i := range problem.ProblemTestCases {
+		testCase := &problem.ProblemTestCases[i]
+		if testCase.DeleteIt {
+			continue
+		}
+
+		if len(testCase.InputData) > inlineTestDataLimit {
+			key, size, sum, err := putTestData(c, strings.NewReader(testCase.InputData), TestDataInput)
+			if err != nil {
+				removeTestData(c, keys)
+				return nil, err
+			}
+			testCase.InputData, testCase.InputKey, testCase.InputSize, testCase.InputSum = "", key, size, sum
+			keys = append(keys, key)
+		}
+
+		if len(testCase.ExpectedOutput) > inlineTestDataLimit {
+			key, size, sum, err := putTestData(c, strings.NewReader(testCase.ExpectedOutput), TestDataOutput)
+			if err != nil {
+				removeTestData(c, keys)
+				return nil, err
+			}
+			testCase.ExpectedOutput, testCase.OutputKey, testCase.OutputSize, testCase.OutputSum = "", key, size, sum
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// keys of test data in store
+func testDataKeys(problem *model.Problem) []string {
+	var keys []string
+	for _, testCase := range problem.ProblemTestCases {
+		if testCase.InputKey != "" {
+			keys = append(keys, testCase.InputKey)
+		}
+		if testCase.OutputKey != "" {
+			keys = append(keys, testCase.OutputKey)
+		}
+	}
+	return keys
+}
+
+// keys of test data are managed by server, so clear keys of new test cases
+func clearTestDataKeys(problem *model.Problem) {
+	for i := range problem.ProblemTestCases {
+		testCase := &problem.ProblemTestCases[i]
+		testCase.InputKey, testCase.InputSize, testCase.InputSum = "", 0, ""
+		testCase.OutputKey, testCase.OutputSize, testCase.OutputSum = "", 0, ""
+	}
+}
+
+// test data isn't returned when get problem,
+// so keep the old test data when test data of test case is empty,
+// replaced test data in store is marked as garbage when revision is recorded
+func fillTestCases(c *gin.Context, problem *model.Problem) error {
+	var oldTestCases []model.ProblemTestCase
+
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	err := db.Where("problem_id = ?", problem.ID).Find(&oldTestCases).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get test cases of problem", problem.ID) != mysql.Success {
+		return err
+	}
+	oldMap := make(map[int]model.ProblemTestCase)
+	for _, testCase := range oldTestCases {
+		oldMap[testCase.ID] = testCase
+	}
+
+	for i := range problem.ProblemTestCases {
+		testCase := &problem.ProblemTestCases[i]
+		old, ok := oldMap[testCase.ID]
+		if !ok {
+			// new test case
+			testCase.InputKey, testCase.InputSize, testCase.InputSum = "", 0, ""
+			testCase.OutputKey, testCase.OutputSize, testCase.OutputSum = "", 0, ""
+			continue
+		}
+
+		if testCase.DeleteIt {
+			continue
+		}
+
+		if testCase.InputData == "" {
+			testCase.InputData, testCase.InputKey, testCase.InputSize, testCase.InputSum =
+				old.InputData, old.InputKey, old.InputSize, old.InputSum
+		} else {
+			testCase.InputKey, testCase.InputSize, testCase.InputSum = "", 0, ""
+		}
+
+		if testCase.ExpectedOutput == "" {
+			testCase.ExpectedOutput, testCase.OutputKey, testCase.OutputSize, testCase.OutputSum =
+				old.ExpectedOutput, old.OutputKey, old.OutputSize, old.OutputSum
+		} else {
+			testCase.OutputKey, testCase.OutputSize, testCase.OutputSum = "", 0, ""
+		}
+	}
+
+	return nil
+}
+
+// load test data from store to inline field
+func loadTestData(c *gin.Context, testCase *model.ProblemTestCase) error {
+	load := func(key string, to *string) error {
+		if key == "" {
+			return nil
+		}
+
+		r, _, _, err := openTestData(c, key, "")
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		content, err := ioutil.ReadAll(r)
+		if err != nil {
+			log.For(c.Request.Context()).Error("read test data fail", zap.Error(err), zap.String("key", key))
+			wrap.SetInternalServerError(c, err)
+			return err
+		}
+		*to = string(content)
+		return nil
+	}
+
+	if err := load(testCase.InputKey, &testCase.InputData); err != nil {
+		return err
+	}
+	return load(testCase.OutputKey, &testCase.ExpectedOutput)
+}
+
+// open test data in store, or inline data when key is empty
+func openTestData(c *gin.Context, key string, inline string) (io.ReadCloser, int64, string, error) {
+	ctx := c.Request.Context()
+
+	if key == "" {
+		sum := sha256.Sum256([]byte(inline))
+		return ioutil.NopCloser(strings.NewReader(inline)), int64(len(inline)), hex.EncodeToString(sum[:]), nil
+	}
+
+	r, err := gbl.Store.Get(ctx, key)
+	if err == store.ErrNotFound {
+		log.For(ctx).Error("test data not exist in store", zap.String("key", key))
+		_ = c.Error(err).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrNotFound.WithArgs(key))
+		return nil, 0, "", err
+	} else if err != nil {
+		log.For(ctx).Error("get test data from store fail", zap.Error(err), zap.String("key", key))
+		wrap.SetInternalServerError(c, err)
+		return nil, 0, "", err
+	}
+
+	return r, -1, "", nil
+}
+
+func getTestCase4Manage(c *gin.Context, problemID int, caseID int) (*model.ProblemTestCase, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	// only owner and administrator can access test data
+	if _, err := getProblem4Manage(c, problemID); err != nil {
+		return nil, err
+	}
+
+	testCase := model.ProblemTestCase{}
+	err := db.Where("problem_id = ?", problemID).First(&testCase, caseID).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get test case", caseID) != mysql.Success {
+		return nil, err
+	}
+
+	return &testCase, nil
+}
+
+// upload test data of test case to store, kind is input or output
+func UploadTestData(c *gin.Context, problemID int, caseID int, kind string, r io.Reader) (*model.ProblemTestCase, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	testCase, err := getTestCase4Manage(c, problemID, caseID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, size, sum, err := putTestData(c, r, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	// update and record revision in one transaction,
+	// uploaded test data is removed when fail
+	tx := db.Begin()
+	rollback := func(err error) (*model.ProblemTestCase, error) {
+		tx.Rollback()
+		removeTestData(c, []string{key})
+		return nil, err
+	}
+
+	before, err := takeSnapshot(c, tx, problemID)
+	if err != nil {
+		return rollback(err)
+	}
+
+	var updates map[string]interface{}
+	if kind == TestDataInput {
+		testCase.InputData, testCase.InputKey, testCase.InputSize, testCase.InputSum = "", key, size, sum
+		updates = map[string]interface{}{
+			"input_data": "",
+			"input_key":  key,
+			"input_size": size,
+			"input_sum":  sum,
+		}
+	} else {
+		testCase.ExpectedOutput, testCase.OutputKey, testCase.OutputSize, testCase.OutputSum = "", key, size, sum
+		updates = map[string]interface{}{
+			"expected_output": "",
+			"output_key":      key,
+			"output_size":     size,
+			"output_sum":      sum,
+		}
+	}
+
+	err = tx.Model(&model.ProblemTestCase{ID: caseID}).Updates(updates).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"update test data of test case", caseID) != mysql.Success {
+		return rollback(err)
+	}
+
+	// old test data is kept in store for revisions
+	after, err := takeSnapshot(c, tx, problemID)
+	if err != nil {
+		return rollback(err)
+	}
+	commit := fmt.Sprintf("upload %s of test case %d", kind, caseID)
+	if err := recordRevision(c, tx, problemID, before, after, commit); err != nil {
+		return rollback(err)
+	}
+
+	err = tx.Commit().Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"commit test data of test case", caseID) != mysql.Success {
+		removeTestData(c, []string{key})
+		return nil, err
+	}
+
+	log.For(ctx).Info("upload test data success", zap.Int("caseID", caseID),
+		zap.String("kind", kind), zap.Int64("size", size))
+	return testCase, nil
+}
+
+// get test data of test case, return reader, size and sha256 checksum,
+// the caller should close the reader
+func GetTestData(c *gin.Context, problemID int, caseID int, kind string) (io.ReadCloser, int64, string, error) {
+	testCase, err := getTestCase4Manage(c, problemID, caseID)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	if kind == TestDataInput {
+		if testCase.InputKey == "" {
+			return openTestData(c, "", testCase.InputData)
+		}
+		r, _, _, err := openTestData(c, testCase.InputKey, "")
+		return r, testCase.InputSize, testCase.InputSum, err
+	}
+
+	if testCase.OutputKey == "" {
+		return openTestData(c, "", testCase.ExpectedOutput)
+	}
+	r, _, _, err := openTestData(c, testCase.OutputKey, "")
+	return r, testCase.OutputSize, testCase.OutputSum, err
+}
+
+// references of test cases for judger, judger fetch test data by itself
+func getTestCaseRefs(c *gin.Context, problemID int) ([]data.TestCaseRef, error) {
+	var testCases []model.ProblemTestCase
+	var refs []data.TestCaseRef
+
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	err := db.Select(testCaseMetaColumns).Where("problem_id = ?", problemID).
+		Order("id").Find(&testCases).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get test cases of problem", problemID) != mysql.Success {
+		return nil, err
+	}
+	if len(testCases) == 0 {
+		err = fmt.Errorf("problem %d has no test case", problemID)
+		log.For(ctx).Error("problem has no test case", zap.Int("problemID", problemID))
+		wrap.SetInternalServerError(c, err)
+		return nil, err
+	}
+
+	for _, testCase := range testCases {
+		refs = append(refs, data.TestCaseRef{
+			ID:        testCase.ID,
+			InputKey:  testCase.InputKey,
+			InputSum:  testCase.InputSum,
+			OutputKey: testCase.OutputKey,
+			OutputSum: testCase.OutputSum,
+			Weight:    testCase.Weight,
+		})
+	}
+
+	return refs, nil
+}
@@ -0,0 +1,138 @@
+package srv
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/si9ma/KillOJ-backend/auth"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/language"
+	"github.com/si9ma/KillOJ-common/judge"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/si9ma/KillOJ-common/mysql"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	heatmapDays        = 365
+	recentAcceptedSize = 10
+	dateLayout         = "2006-01-02"
+)
+
+// statistics of user, only complete submits are counted,
+// solved problems by difficulty and tag and recent accepted problems
+// only include problems visible to current user
+func GetUserStats(c *gin.Context, id int) (*data.UserStats, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	myID := auth.GetUserFromJWT(c).ID
+	acCode := judge.AcceptedStatus.Code
+
+	// check if user exist
+	err := db.First(&model.User{}, id).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get user", id) != mysql.Success {
+		return nil, err
+	}
+
+	stats := data.UserStats{UserID: id}
+	submitDB := db.Table("submit").Where("submit.user_id = ? AND submit.is_complete = ?", id, true)
+	acDB := submitDB.Where("submit.result = ?", acCode)
+
+	// total
+	err = submitDB.Count(&stats.SubmitCount).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "count submits of user", id) != mysql.Success {
+		return nil, err
+	}
+	err = acDB.Select("count(distinct submit.problem_id)").Row().Scan(&stats.SolvedCount)
+	if mysql.ErrorHandleAndLog(c, err, true, "count solved problems of user", id) != mysql.Success {
+		return nil, err
+	}
+
+	// solved by difficulty and tag, only problems visible to current user are counted
+	now := time.Now()
+	visibleAcDB := acDB.Joins("join problem on problem.id = submit.problem_id AND problem.deleted_at IS NULL").
+		Where(visibleProblemCond, myID, myID, myID, now, myID, now)
+	err = visibleAcDB.Select("problem.difficulty, count(distinct problem.id) as count").
+		Group("problem.difficulty").Order("problem.difficulty").Scan(&stats.SolvedByDifficulty).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "count solved problems by difficulty", id) != mysql.Success {
+		return nil, err
+	}
+	err = visibleAcDB.Select("tag.id as tag_id, tag.name, count(distinct submit.problem_id) as count").
+		Joins("join problem_has_tag on problem_has_tag.problem_id = submit.problem_id").
+		Joins("join tag on tag.id = problem_has_tag.tag_id").
+		Group("tag.id, tag.name").Order("count desc").Scan(&stats.SolvedByTag).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "count solved problems by tag", id) != mysql.Success {
+		return nil, err
+	}
+
+	// distribution of verdict and language
+	err = submitDB.Select("submit.result, count(*) as count").
+		Group("submit.result").Order("submit.result").Scan(&stats.Verdicts).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "count verdicts of user", id) != mysql.Success {
+		return nil, err
+	}
+	for i := range stats.Verdicts {
+		stats.Verdicts[i].Msg = statusOfCode(stats.Verdicts[i].Result).Msg
+	}
+	err = submitDB.Select("submit.language, count(*) as count").
+		Group("submit.language").Order("count desc").Scan(&stats.Languages).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "count languages of user", id) != mysql.Success {
+		return nil, err
+	}
+	for i := range stats.Languages {
+		if lang, ok := language.Get(stats.Languages[i].Language); ok {
+			stats.Languages[i].Name = lang.Name
+		}
+	}
+
+	// daily submits of last year
+	var daily []data.DailyCount
+	to := time.Now()
+	from := to.AddDate(0, 0, -(heatmapDays - 1))
+	err = submitDB.Select("date_format(submit.created_at, '%Y-%m-%d') as date, count(*) as count").
+		Where("submit.created_at >= ?", from.Format(dateLayout)).
+		Group("date").Scan(&daily).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "count daily submits of user", id) != mysql.Success {
+		return nil, err
+	}
+	stats.Heatmap = fillHeatmap(daily, from, to)
+
+	// recent accepted
+	err = acDB.Select("submit.problem_id, problem.name, max(submit.created_at) as accepted_at").
+		Joins("join problem on problem.id = submit.problem_id AND problem.deleted_at IS NULL").
+		Where(visibleProblemCond, myID, myID, myID, to, myID, to).
+		Group("submit.problem_id, problem.name").Order("accepted_at desc").
+		Limit(recentAcceptedSize).Scan(&stats.RecentAccepted).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get recent accepted problems of user", id) != mysql.Success {
+		return nil, err
+	}
+
+	log.For(ctx).Info("success get stats of user", zap.Int("userID", id))
+	return &stats, nil
+}
+
+// fill days without submit, from and to are included
+func fillHeatmap(daily []data.DailyCount, from, to time.Time) []data.DailyCount {
+	counts := make(map[string]int)
+	for _, item := range daily {
+		counts[item.Date] = item.Count
+	}
+
+	heatmap := []data.DailyCount{}
+	end := to.Format(dateLayout)
+	for day := from; ; day = day.AddDate(0, 0, 1) {
+		date := day.Format(dateLayout)
+		heatmap = append(heatmap, data.DailyCount{
+			Date:  date,
+			Count: counts[date],
+		})
+		if date >= end {
+			break
+		}
+	}
+
+	return heatmap
+}
@@ -0,0 +1,26 @@
+package srv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFillHeatmap(t *testing.T) {
+	from := time.Date(2019, 2, 27, 10, 0, 0, 0, time.Local)
+	to := time.Date(2019, 3, 2, 8, 0, 0, 0, time.Local)
+	daily := []data.DailyCount{
+		{Date: "2019-02-28", Count: 3},
+		{Date: "2019-03-02", Count: 1},
+	}
+
+	heatmap := fillHeatmap(daily, from, to)
+	assert.Equal(t, []data.DailyCount{
+		{Date: "2019-02-27", Count: 0},
+		{Date: "2019-02-28", Count: 3},
+		{Date: "2019-03-01", Count: 0},
+		{Date: "2019-03-02", Count: 1},
+	}, heatmap)
+}
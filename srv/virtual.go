@@ -0,0 +1,278 @@
+package srv
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/si9ma/KillOJ-backend/auth"
+	"github.com/si9ma/KillOJ-backend/data"
+	"github.com/si9ma/KillOJ-backend/gbl"
+	"github.com/si9ma/KillOJ-backend/kerror"
+	"github.com/si9ma/KillOJ-backend/wrap"
+	"github.com/si9ma/KillOJ-common/kjson"
+	"github.com/si9ma/KillOJ-common/kredis"
+	"github.com/si9ma/KillOJ-common/log"
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/si9ma/KillOJ-common/mysql"
+	otgrom "github.com/smacker/opentracing-gorm"
+	"go.uber.org/zap"
+)
+
+// start virtual participation of ended contest,
+// every user allowed by getContest4Virtual can start only one virtual participation
+func StartVirtual(c *gin.Context, contestID int, arg *data.VirtualArg) (*model.VirtualParticipation, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	myID := auth.GetUserFromJWT(c).ID
+
+	contest, err := getContest4Virtual(c, contestID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if contestPhase(contest, now) != model.ContestEnded {
+		log.For(ctx).Error("contest hasn't ended", zap.Int("contestId", contestID))
+		_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrContestNotEnded)
+		return nil, kerror.EmptyError
+	}
+
+	// check if already have virtual participation
+	count := 0
+	err = db.Model(&model.VirtualParticipation{}).
+		Where("contest_id = ? AND user_id = ?", contestID, myID).Count(&count).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"check if virtual participation exist", contestID) != mysql.Success {
+		return nil, err
+	}
+	if count > 0 {
+		log.For(ctx).Error("virtual participation already exist",
+			zap.Int("contestId", contestID), zap.Int("userId", myID))
+		_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrAlreadyExist.WithArgs("virtual participation"))
+		return nil, kerror.EmptyError
+	}
+
+	startTime := now
+	if arg.StartTime != nil {
+		startTime = *arg.StartTime
+	}
+	virtual := model.VirtualParticipation{
+		ContestID: contestID,
+		UserID:    myID,
+		StartTime: startTime,
+		EndTime:   startTime.Add(contest.EndTime.Sub(contest.StartTime)),
+	}
+	err = db.Create(&virtual).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"save virtual participation", contestID) != mysql.Success {
+		return nil, err
+	}
+
+	log.For(ctx).Info("success start virtual participation",
+		zap.Int("contestId", contestID), zap.Time("startTime", startTime))
+	return &virtual, nil
+}
+
+// virtual participant needn't be participant of contest,
+// so virtual participation is queried directly
+func GetMyVirtual(c *gin.Context, contestID int) (*model.VirtualParticipation, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	myID := auth.GetUserFromJWT(c).ID
+
+	virtual := model.VirtualParticipation{}
+	err := db.Where("contest_id = ? AND user_id = ?", contestID, myID).First(&virtual).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get virtual participation", contestID) != mysql.Success {
+		return nil, err
+	}
+
+	return &virtual, nil
+}
+
+// contest can be practised in virtual participation by participants of contest,
+// anyone when registration of contest is public, and members of invite groups of contest
+func getContest4Virtual(c *gin.Context, id int) (*model.Contest, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	myID := auth.GetUserFromJWT(c).ID
+
+	contest := model.Contest{}
+	err := db.Preload("Owner").First(&contest, id).Error
+	if mysql.ErrorHandleAndLog(c, err, true, "get contest", id) != mysql.Success {
+		return nil, err
+	}
+
+	allowed, err := canStartVirtual(c, &contest, myID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		log.For(ctx).Error("user can't start virtual participation of contest",
+			zap.Int("contestId", id), zap.Int("userId", myID))
+		_ = c.Error(kerror.EmptyError).SetType(gin.ErrorTypePublic).
+			SetMeta(kerror.ErrNotFound.WithArgs(id))
+		return nil, kerror.EmptyError
+	}
+
+	contest.Phase = contestPhase(&contest, time.Now())
+	return &contest, nil
+}
+
+func canStartVirtual(c *gin.Context, contest *model.Contest, userID int) (bool, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	redisCli := kredis.WrapRedisClusterClient(ctx, gbl.Redis)
+
+	if contest.RegisterMode == model.RegisterByPublic || contest.OwnerID == userID {
+		return true, nil
+	}
+
+	count := 0
+	err := db.Model(&model.UserInContest{}).
+		Where("contest_id = ? AND user_id = ?", contest.ID, userID).Count(&count).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"check if participant exist", contest.ID) != mysql.Success {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	// invite has expired after contest end, the allowed groups of it are kept,
+	// invite without allowed groups is open to everyone who has link, so it doesn't count
+	k := ContestInviteGroupsPrefix + strconv.Itoa(contest.ID)
+	val, err := redisCli.Get(k).Result()
+	switch kredis.ErrorHandleAndLog(c, err, false, "get invite groups of contest", k, contest.ID) {
+	case kredis.Success:
+	case kredis.NotFound:
+		return false, nil
+	default:
+		return false, err
+	}
+	var groups []int
+	if err := kjson.UnmarshalString(val, &groups); err != nil {
+		log.For(ctx).Error("unmarshal json fail", zap.Error(err), zap.String("key", k))
+		wrap.SetInternalServerError(c, err)
+		return false, err
+	}
+	if len(groups) == 0 {
+		return false, nil
+	}
+
+	// same as join by invite, member of any allowed group is allowed
+	err = db.Model(&model.UserInGroup{}).
+		Where("group_id in (?) AND user_id = ?", groups, userID).Count(&count).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"check if member of invite groups", contest.ID) != mysql.Success {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// get contest of started virtual participation of myself,
+// return nil without error when there isn't one, so caller can fall back to other permission
+func getVirtualContest(c *gin.Context, id int) (*model.Contest, error) {
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+	myID := auth.GetUserFromJWT(c).ID
+
+	contest := model.Contest{}
+	err := db.Preload("Owner").
+		Joins("join virtual_participation on virtual_participation.contest_id = contest.id").
+		Where("virtual_participation.user_id = ? AND virtual_participation.start_time <= ?", myID, time.Now()).
+		First(&contest, id).Error
+	switch mysql.ErrorHandleAndLog(c, err, false, "get contest of virtual participation", id) {
+	case mysql.Success:
+	case mysql.NotFound:
+		return nil, nil
+	default:
+		return nil, err
+	}
+
+	contest.Phase = contestPhase(&contest, time.Now())
+	return &contest, nil
+}
+
+// ghost entries of virtual participations, they don't affect statistic of problems
+func getVirtualRows(c *gin.Context, contest *model.Contest, problems []model.Problem,
+	weights map[int]map[int]int) ([]data.ScoreboardEntry, error) {
+	var (
+		virtuals []model.VirtualParticipation
+		submits  []model.Submit
+	)
+
+	ctx := c.Request.Context()
+	db := otgrom.SetSpanToGorm(ctx, gbl.DB)
+
+	err := db.Preload("User").Where("contest_id = ?", contest.ID).Find(&virtuals).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get virtual participations of contest", contest.ID) != mysql.Success {
+		return nil, err
+	}
+	if len(virtuals) == 0 || len(problems) == 0 {
+		return nil, nil
+	}
+
+	var problemIDs []int
+	for _, problem := range problems {
+		problemIDs = append(problemIDs, problem.ID)
+	}
+
+	var userIDs []int
+	for _, virtual := range virtuals {
+		userIDs = append(userIDs, virtual.UserID)
+	}
+
+	err = db.Where("problem_id in (?) AND user_id in (?) AND is_complete = ?", problemIDs, userIDs, true).
+		Order("created_at").Order("id").Find(&submits).Error
+	if mysql.ErrorHandleAndLog(c, err, true,
+		"get submits of virtual participations", contest.ID) != mysql.Success {
+		return nil, err
+	}
+
+	users, submits := shiftVirtualSubmits(contest, virtuals, submits)
+	board := calcScoreboard(contest, problems, weights, users, nil, submits, nil, time.Now())
+	for i := range board.Rows {
+		board.Rows[i].IsVirtual = true
+		for j := range board.Rows[i].Problems {
+			board.Rows[i].Problems[j].IsFirstBlood = false
+		}
+	}
+
+	return board.Rows, nil
+}
+
+// keep submits during virtual participation, and shift them to the time window of contest,
+// so that they can be scored as real submits
+func shiftVirtualSubmits(contest *model.Contest, virtuals []model.VirtualParticipation,
+	submits []model.Submit) ([]model.User, []model.Submit) {
+	var (
+		users   []model.User
+		shifted []model.Submit
+	)
+
+	windows := make(map[int]*model.VirtualParticipation)
+	for i := range virtuals {
+		windows[virtuals[i].UserID] = &virtuals[i]
+		users = append(users, virtuals[i].User)
+	}
+
+	for _, submit := range submits {
+		virtual, ok := windows[submit.UserID]
+		if !ok || submit.CreatedAt.Before(virtual.StartTime) || submit.CreatedAt.After(virtual.EndTime) {
+			continue
+		}
+		submit.CreatedAt = contest.StartTime.Add(submit.CreatedAt.Sub(virtual.StartTime))
+		shifted = append(shifted, submit)
+	}
+
+	sort.SliceStable(shifted, func(i, j int) bool {
+		return shifted[i].CreatedAt.Before(shifted[j].CreatedAt)
+	})
+	return users, shifted
+}
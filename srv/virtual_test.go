@@ -0,0 +1,37 @@
+package srv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/si9ma/KillOJ-common/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShiftVirtualSubmits(t *testing.T) {
+	start := time.Date(2019, 3, 1, 9, 0, 0, 0, time.Local)
+	contest := &model.Contest{
+		StartTime: start,
+		EndTime:   start.Add(2 * time.Hour),
+	}
+	virtuals := []model.VirtualParticipation{
+		{UserID: 1, User: model.User{ID: 1}, StartTime: start.Add(24 * time.Hour), EndTime: start.Add(26 * time.Hour)},
+		{UserID: 2, User: model.User{ID: 2}, StartTime: start.Add(48 * time.Hour), EndTime: start.Add(50 * time.Hour)},
+	}
+	submits := []model.Submit{
+		{ID: 1, UserID: 1, CreatedAt: start.Add(23 * time.Hour)},                // before virtual start
+		{ID: 2, UserID: 1, CreatedAt: start.Add(24*time.Hour + 30*time.Minute)}, // 30 minutes
+		{ID: 3, UserID: 3, CreatedAt: start.Add(24*time.Hour + 40*time.Minute)}, // not virtual participant
+		{ID: 4, UserID: 2, CreatedAt: start.Add(48*time.Hour + 10*time.Minute)}, // 10 minutes
+		{ID: 5, UserID: 1, CreatedAt: start.Add(27 * time.Hour)},                // after virtual end
+	}
+
+	users, shifted := shiftVirtualSubmits(contest, virtuals, submits)
+	assert.Len(t, users, 2)
+	if assert.Len(t, shifted, 2) {
+		assert.Equal(t, 4, shifted[0].ID)
+		assert.Equal(t, start.Add(10*time.Minute), shifted[0].CreatedAt)
+		assert.Equal(t, 2, shifted[1].ID)
+		assert.Equal(t, start.Add(30*time.Minute), shifted[1].CreatedAt)
+	}
+}
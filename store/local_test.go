@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewLocalStore(LocalConfig{Dir: dir})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	assert.NoError(t, s.Put(ctx, "test_cases/1.input", strings.NewReader("1 2"), 3))
+	r, err := s.Get(ctx, "test_cases/1.input")
+	assert.NoError(t, err)
+	content, _ := ioutil.ReadAll(r)
+	r.Close()
+	assert.Equal(t, "1 2", string(content))
+
+	// size mismatch
+	assert.Error(t, s.Put(ctx, "test_cases/2.input", strings.NewReader("1 2"), 4))
+	// escape from directory
+	assert.Error(t, s.Put(ctx, "../1.input", strings.NewReader("1 2"), 3))
+
+	assert.NoError(t, s.Delete(ctx, "test_cases/1.input"))
+	assert.NoError(t, s.Delete(ctx, "test_cases/1.input"))
+	_, err = s.Get(ctx, "test_cases/1.input")
+	assert.Equal(t, ErrNotFound, err)
+}
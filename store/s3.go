@@ -0,0 +1,140 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+const (
+	s3Service       = "s3"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"` // eg: https://s3.amazonaws.com or address of minio
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"accessKey"`
+	SecretKey string `yaml:"secretKey"`
+	PathStyle bool   `yaml:"pathStyle"` // use path style url, it's necessary for most S3 compatible storage
+}
+
+// store data in S3 compatible object storage,
+// only object api is used, so we sign the request by ourself
+type S3Store struct {
+	cfg    S3Config
+	signer *v4.Signer
+	client *http.Client
+}
+
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("endpoint and bucket of s3 store must not be empty")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	return &S3Store{
+		cfg:    cfg,
+		signer: v4.NewSigner(credentials.NewStaticCredentials(cfg.AccessKey, cfg.SecretKey, "")),
+		client: &http.Client{},
+	}, nil
+}
+
+func (s *S3Store) objectURL(key string) (string, error) {
+	u, err := url.Parse(s.cfg.Endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	if s.cfg.PathStyle {
+		u.Path = "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	return u.String(), nil
+}
+
+func (s *S3Store) do(ctx context.Context, method string, key string, body io.Reader, size int64) (*http.Response, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.ContentLength = size
+	}
+
+	// don't sign payload, so that data can be streamed
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	if _, err := s.signer.Sign(req, nil, s3Service, s.cfg.Region, time.Now()); err != nil {
+		return nil, err
+	}
+	// signer reset body when body param is nil
+	if body != nil {
+		req.Body = ioutil.NopCloser(body)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s %s fail(%d): %s", method, key, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return resp, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if size < 0 {
+		return fmt.Errorf("size of %s is unknown", key)
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, key, r, size)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0)
+	if err == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
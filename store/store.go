@@ -0,0 +1,56 @@
+// pluggable storage for large data, eg: test data of problem
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	LocalType = "local"
+	S3Type    = "s3"
+
+	DefaultMaxSize = 256 << 20 // 256MB
+)
+
+var ErrNotFound = errors.New("object not found")
+
+type Config struct {
+	Type    string      `yaml:"type"`    // local(default) or s3
+	MaxSize int64       `yaml:"maxSize"` // max size of uploaded data in bytes, default is DefaultMaxSize
+	Local   LocalConfig `yaml:"local"`
+	S3      S3Config    `yaml:"s3"`
+}
+
+// max size of uploaded data
+func (cfg Config) MaxDataSize() int64 {
+	if cfg.MaxSize <= 0 {
+		return DefaultMaxSize
+	}
+	return cfg.MaxSize
+}
+
+type Store interface {
+	// save data of key, size is the length of data
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+
+	// get data of key, return ErrNotFound when not exist,
+	// the caller should close the reader
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// delete data of key, it's not an error when key not exist
+	Delete(ctx context.Context, key string) error
+}
+
+func Init(cfg Config) (Store, error) {
+	switch cfg.Type {
+	case "", LocalType:
+		return NewLocalStore(cfg.Local)
+	case S3Type:
+		return NewS3Store(cfg.S3)
+	default:
+		return nil, fmt.Errorf("store type %s is not supported", cfg.Type)
+	}
+}
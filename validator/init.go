@@ -9,5 +9,7 @@ func SetupValidator() {
 	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
 		v.RegisterValidation("oneof", oneOf)
 		v.RegisterValidation("requiredwhenfield", requireWhenFieldNotEmpty)
+		v.RegisterValidation("requiredwhenfieldempty", requireWhenFieldEmpty)
+		v.RegisterValidation("language", languageExist)
 	}
 }
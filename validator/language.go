@@ -0,0 +1,23 @@
+package validator
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/si9ma/KillOJ-backend/language"
+
+	"gopkg.in/go-playground/validator.v8"
+)
+
+// language should exist in language registry
+func languageExist(
+	v *validator.Validate, topStruct reflect.Value, currentStructOrField reflect.Value,
+	field reflect.Value, fieldType reflect.Type, fieldKind reflect.Kind, param string,
+) bool {
+	switch fieldKind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return language.Exist(int(field.Int()))
+	default:
+		panic(fmt.Sprintf("Bad field type %T", field.Interface()))
+	}
+}
@@ -19,3 +19,16 @@ func requireWhenFieldNotEmpty(
 
 	return true
 }
+
+// required when field of param is empty, e.g. required when create
+func requireWhenFieldEmpty(
+	v *validator.Validate, topStruct reflect.Value, currentStructOrField reflect.Value,
+	field reflect.Value, fieldType reflect.Type, fieldKind reflect.Kind, param string,
+) bool {
+	f := reflect.Indirect(currentStructOrField).FieldByName(param)
+	if utils.IsZeroOfUnderlyingType(f.Interface()) {
+		return !utils.IsZeroOfUnderlyingType(field.Interface())
+	}
+
+	return true
+}
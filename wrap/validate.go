@@ -6,6 +6,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/si9ma/KillOJ-common/log"
 	"gopkg.in/go-playground/validator.v8"
 )
@@ -24,15 +25,33 @@ func ShouldBind(c *gin.Context, obj interface{}, BindUri bool) (ok bool) {
 	if err != nil {
 		log.For(ctx).Error("bind arguments fail", zap.Error(err),
 			zap.Any("obj", obj))
+		setValidateError(c, err)
+		return false
+	}
+
+	return true
+}
 
-		if _, ok := err.(validator.ValidationErrors); ok {
-			_ = c.Error(err).SetType(gin.ErrorTypeBind)
-		}
+// validate obj which isn't bound from request, e.g. parsed from upload file,
+// with the same rules as binding
+func Validate(c *gin.Context, obj interface{}) (ok bool) {
+	ctx := c.Request.Context()
 
-		_ = c.Error(err).SetType(gin.ErrorTypePublic)
-		c.Status(http.StatusBadRequest)
+	if err := binding.Validator.ValidateStruct(obj); err != nil {
+		log.For(ctx).Error("validate arguments fail", zap.Error(err),
+			zap.Any("obj", obj))
+		setValidateError(c, err)
 		return false
 	}
 
 	return true
 }
+
+func setValidateError(c *gin.Context, err error) {
+	if _, ok := err.(validator.ValidationErrors); ok {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+	}
+
+	_ = c.Error(err).SetType(gin.ErrorTypePublic)
+	c.Status(http.StatusBadRequest)
+}